@@ -0,0 +1,269 @@
+// Package aggregate provides stateful functions aggregating the events seen
+// by rules over sliding windows of time:
+//
+//	count_over(key, window)          events recorded for key in the window
+//	sum_over(key, value, window)     sum of the values recorded for key
+//	distinct_over(key, value, window) distinct values recorded for key
+//	rate(key, window)                events per second recorded for key
+//
+// Every call records the event being evaluated before aggregating, so the
+// count includes it. The key names the series: a string, a number or a list
+// of them, e.g. count_over(list(action, user), "10m") counts the events of
+// each action per user. The value expression of sum_over and distinct_over
+// is part of the name too. The window is a duration such as "10m" or a number
+// of seconds.
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+const (
+	CountOverFN    = "COUNT_OVER"
+	SumOverFN      = "SUM_OVER"
+	DistinctOverFN = "DISTINCT_OVER"
+	RateFN         = "RATE"
+)
+
+// Aggregator implements the aggregate functions on top of a Store
+type Aggregator struct {
+	store Store
+
+	// Now returns the time of the events evaluated outside of Observe, it
+	// can be replaced in tests
+	Now func() time.Time
+}
+
+func New(store Store) *Aggregator {
+	return &Aggregator{store: store, Now: time.Now}
+}
+
+// Register registers the aggregate functions on en
+func (a *Aggregator) Register(en *evaluator.Engine) error {
+	fns := map[string]evaluator.ContextFunction{
+		CountOverFN:    a.countOver,
+		SumOverFN:      a.sumOver,
+		DistinctOverFN: a.distinctOver,
+		RateFN:         a.rate,
+	}
+	for name, fn := range fns {
+		if err := en.RegisterContext(name, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type event struct {
+	at       time.Time
+	mtx      *sync.Mutex
+	recorded map[string]bool
+}
+
+type eventKey struct{}
+
+// Observe RETURNS a context for evaluating the rules against one event
+// that happened at at. Under it, the calls sharing a function and a key
+// record the event once, however many rules aggregate it. Without it,
+// every call records the event at a.Now()
+func (a *Aggregator) Observe(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, eventKey{}, &event{at: at, mtx: &sync.Mutex{}, recorded: make(map[string]bool)})
+}
+
+// record adds obs to series unless the event was already recorded in it,
+// and RETURNS the time of the event
+func (a *Aggregator) record(ctx context.Context, series string, obs Observation) (time.Time, error) {
+	ev, ok := ctx.Value(eventKey{}).(*event)
+	if !ok {
+		obs.Time = a.Now()
+		return obs.Time, a.store.Add(series, obs)
+	}
+
+	ev.mtx.Lock()
+	defer ev.mtx.Unlock()
+
+	obs.Time = ev.at
+	if ev.recorded[series] {
+		return ev.at, nil
+	}
+	if err := a.store.Add(series, obs); err != nil {
+		return ev.at, err
+	}
+	ev.recorded[series] = true
+
+	return ev.at, nil
+}
+
+// aggregate records obs and RETURNS the observations of the window. The
+// series of sum_over and distinct_over are also named after the expression
+// of their value, sum_over(user, amount, ...) and sum_over(user, fee, ...)
+// don't share one
+func (a *Aggregator) aggregate(ctx context.Context, kind string, key evaluator.Object, window time.Duration, obs Observation) ([]Observation, error) {
+	k, err := seriesKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	series := kind + "\x00" + k
+	if kind != "count" {
+		if call, ok := evaluator.CallFrom(ctx); ok && len(call.Arguments) > 1 {
+			series += "\x00" + parser.Format(call.Arguments[1])
+		}
+	}
+
+	now, err := a.record(ctx, series, obs)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.store.Range(series, now.Add(-window), now)
+}
+
+// count_over(key, window)
+func (a *Aggregator) countOver(ctx context.Context, args []evaluator.Object) (evaluator.Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+	window, err := duration(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	observations, err := a.aggregate(ctx, "count", args[0], window, Observation{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &evaluator.Number{Value: float64(len(observations))}, nil
+}
+
+// rate(key, window) shares the series of count_over
+func (a *Aggregator) rate(ctx context.Context, args []evaluator.Object) (evaluator.Object, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+	window, err := duration(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	observations, err := a.aggregate(ctx, "count", args[0], window, Observation{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &evaluator.Number{Value: float64(len(observations)) / window.Seconds()}, nil
+}
+
+// sum_over(key, value, window)
+func (a *Aggregator) sumOver(ctx context.Context, args []evaluator.Object) (evaluator.Object, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("expected 3 arguments, got %d", len(args))
+	}
+	value, ok := args[1].(*evaluator.Number)
+	if !ok {
+		return nil, fmt.Errorf("value must be a number, got %s", args[1].Type())
+	}
+	window, err := duration(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	observations, err := a.aggregate(ctx, "sum", args[0], window, Observation{Value: value.Value})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := 0.0
+	for _, o := range observations {
+		sum += o.Value
+	}
+
+	return &evaluator.Number{Value: sum}, nil
+}
+
+// distinct_over(key, value, window)
+func (a *Aggregator) distinctOver(ctx context.Context, args []evaluator.Object) (evaluator.Object, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("expected 3 arguments, got %d", len(args))
+	}
+	label, err := scalar(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("value %s", err)
+	}
+	window, err := duration(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	observations, err := a.aggregate(ctx, "distinct", args[0], window, Observation{Label: label})
+	if err != nil {
+		return nil, err
+	}
+
+	distinct := make(map[string]bool, len(observations))
+	for _, o := range observations {
+		distinct[o.Label] = true
+	}
+
+	return &evaluator.Number{Value: float64(len(distinct))}, nil
+}
+
+// seriesKey RETURNS the string naming the series of key
+func seriesKey(key evaluator.Object) (string, error) {
+	if l, ok := key.(*evaluator.RegexList); ok {
+		parts := make([]string, len(l.Value))
+		for i, re := range l.Value {
+			parts[i] = re.String()
+		}
+		return strings.Join(parts, "\x1f"), nil
+	}
+
+	k, err := scalar(key)
+	if err != nil {
+		return "", fmt.Errorf("key %s", err)
+	}
+	return k, nil
+}
+
+func scalar(obj evaluator.Object) (string, error) {
+	switch obj := obj.(type) {
+	case *evaluator.String:
+		return obj.Value, nil
+	case *evaluator.Number:
+		return strconv.FormatFloat(obj.Value, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("must be a string or a number, got %s", obj.Type())
+	}
+}
+
+// duration parses a window, a duration string or a number of seconds
+func duration(obj evaluator.Object) (time.Duration, error) {
+	var d time.Duration
+	switch obj := obj.(type) {
+	case *evaluator.String:
+		var err error
+		if d, err = time.ParseDuration(obj.Value); err != nil {
+			return 0, fmt.Errorf("invalid window: %s", err)
+		}
+	case *evaluator.Number:
+		d = time.Duration(obj.Value * float64(time.Second))
+	default:
+		return 0, fmt.Errorf("window must be a duration, got %s", obj.Type())
+	}
+
+	if d <= 0 {
+		return 0, errors.New("window must be positive")
+	}
+	return d, nil
+}
@@ -0,0 +1,265 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/pipeline"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newEngine(t *testing.T, store Store) (*evaluator.Engine, *Aggregator) {
+	en := evaluator.NewEngine()
+	a := New(store)
+	if err := a.Register(en); err != nil {
+		t.Fatal(err)
+	}
+
+	return en, a
+}
+
+func TestAggregateFunctions(t *testing.T) {
+	type event struct {
+		offset time.Duration
+		params map[string]interface{}
+		result bool
+	}
+
+	tests := []struct {
+		expression string
+		events     []event
+	}{
+		{
+			`count_over(user, "10m") > 2`,
+			[]event{
+				{0, map[string]interface{}{"user": "a"}, false},
+				{time.Minute, map[string]interface{}{"user": "a"}, false},
+				{2 * time.Minute, map[string]interface{}{"user": "b"}, false},
+				{3 * time.Minute, map[string]interface{}{"user": "a"}, true},
+				// the first event left the window
+				{10 * time.Minute, map[string]interface{}{"user": "a"}, true},
+				{14 * time.Minute, map[string]interface{}{"user": "a"}, false},
+			},
+		},
+		{
+			`count_over(list(action, user), 600) >= 2`,
+			[]event{
+				{0, map[string]interface{}{"user": 1, "action": "login_failed"}, false},
+				{time.Second, map[string]interface{}{"user": 1, "action": "login"}, false},
+				{2 * time.Second, map[string]interface{}{"user": 1, "action": "login_failed"}, true},
+			},
+		},
+		{
+			`sum_over(card, amount, "1h") > 100`,
+			[]event{
+				{0, map[string]interface{}{"card": "c", "amount": 60}, false},
+				{30 * time.Minute, map[string]interface{}{"card": "c", "amount": 50}, true},
+				{61 * time.Minute, map[string]interface{}{"card": "c", "amount": 10}, false},
+			},
+		},
+		{
+			`distinct_over(user, ip, "1h") >= 3`,
+			[]event{
+				{0, map[string]interface{}{"user": "a", "ip": "1.1.1.1"}, false},
+				{time.Minute, map[string]interface{}{"user": "a", "ip": "1.1.1.1"}, false},
+				{2 * time.Minute, map[string]interface{}{"user": "a", "ip": "2.2.2.2"}, false},
+				{3 * time.Minute, map[string]interface{}{"user": "a", "ip": "3.3.3.3"}, true},
+			},
+		},
+		{
+			`rate(user, "1m") > 0.05`,
+			[]event{
+				{0, map[string]interface{}{"user": "a"}, false},
+				{10 * time.Second, map[string]interface{}{"user": "a"}, false},
+				{20 * time.Second, map[string]interface{}{"user": "a"}, false},
+				{30 * time.Second, map[string]interface{}{"user": "a"}, true},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		en, a := newEngine(t, NewMemoryStore(time.Hour))
+		r, err := en.NewRule(tt.expression, nil)
+		if !assert.NoError(t, err, fmt.Sprintf("tests[%d]", i)) {
+			continue
+		}
+
+		for j, ev := range tt.events {
+			now := epoch.Add(ev.offset)
+			a.Now = func() time.Time { return now }
+
+			res, err := r.Evaluate(ev.params)
+			assert.NoError(t, err, fmt.Sprintf("tests[%d] events[%d]", i, j))
+			assert.Equal(t, ev.result, res, fmt.Sprintf("tests[%d] events[%d]", i, j))
+		}
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{`count_over(user) > 1`, "eval: count_over: expected 2 arguments, got 1"},
+		{`count_over(user, "soon") > 1`, `eval: count_over: invalid window: time: invalid duration "soon"`},
+		{`count_over(user, "-1m") > 1`, "eval: count_over: window must be positive"},
+		{`count_over(user, true) > 1`, "eval: count_over: window must be a duration, got Boolean"},
+		{`count_over(flag, "1m") > 1`, "eval: count_over: key must be a string or a number, got Boolean"},
+		{`sum_over(user, user, "1m") > 1`, "eval: sum_over: value must be a number, got String"},
+		{`distinct_over(user, flag, "1m") > 1`, "eval: distinct_over: value must be a string or a number, got Boolean"},
+	}
+
+	for i, tt := range tests {
+		en, _ := newEngine(t, NewMemoryStore(time.Hour))
+		r, err := en.NewRule(tt.expression, nil)
+		if !assert.NoError(t, err, fmt.Sprintf("tests[%d]", i)) {
+			continue
+		}
+
+		_, err = r.Evaluate(map[string]interface{}{"user": "a", "flag": true})
+		assert.EqualError(t, err, tt.err, fmt.Sprintf("tests[%d]", i))
+	}
+}
+
+func TestObserve(t *testing.T) {
+	en, a := newEngine(t, NewMemoryStore(time.Hour))
+	rs := evaluator.NewRuleSet()
+	for _, expr := range []string{`count_over(user, "1h") >= 2`, `count_over(user, "10m") >= 2`, `rate(user, "1m") > 0`} {
+		r, err := en.NewRule(expr, map[string]interface{}{"expr": expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	// the three calls record each event once
+	params := map[string]interface{}{"user": "a"}
+	matched, err := rs.EvalContext(a.Observe(context.Background(), epoch), params)
+	assert.NoError(t, err)
+	assert.Len(t, matched, 1)
+
+	matched, err = rs.EvalContext(a.Observe(context.Background(), epoch.Add(30*time.Minute)), params)
+	assert.NoError(t, err)
+	assert.Len(t, matched, 2)
+	assert.Equal(t, `count_over(user, "1h") >= 2`, matched[0].GetMetadata("expr"))
+}
+
+func TestValueSeries(t *testing.T) {
+	en, a := newEngine(t, NewMemoryStore(time.Hour))
+	rs := evaluator.NewRuleSet()
+	for _, expr := range []string{
+		`sum_over(user, amount, "1h") > 50`,
+		`sum_over(user, fee, "1h") > 5`,
+		`distinct_over(user, ip, "1h") > 1`,
+		`distinct_over(user, device, "1h") > 1`,
+	} {
+		r, err := en.NewRule(expr, map[string]interface{}{"expr": expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	// the calls aggregating different values of the same key don't share
+	// a series, even when the values are equal
+	for i, ev := range []map[string]interface{}{
+		{"user": "a", "amount": 100, "fee": 1, "ip": "1.1.1.1", "device": "d"},
+		{"user": "a", "amount": 1, "fee": 1, "ip": "2.2.2.2", "device": "d"},
+	} {
+		matched, err := rs.EvalContext(a.Observe(context.Background(), epoch.Add(time.Duration(i)*time.Minute)), ev)
+		assert.NoError(t, err)
+
+		exprs := make([]string, 0)
+		for _, r := range matched {
+			exprs = append(exprs, r.GetMetadata("expr").(string))
+		}
+		if i == 0 {
+			assert.Equal(t, []string{`sum_over(user, amount, "1h") > 50`}, exprs)
+		} else {
+			assert.Equal(t, []string{`sum_over(user, amount, "1h") > 50`, `distinct_over(user, ip, "1h") > 1`}, exprs)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(time.Minute)
+
+	// out of order observations are kept sorted
+	for _, sec := range []int{10, 30, 20} {
+		assert.NoError(t, s.Add("a", Observation{Time: epoch.Add(time.Duration(sec) * time.Second), Value: float64(sec)}))
+	}
+	observations, err := s.Range("a", epoch, epoch.Add(time.Minute))
+	assert.NoError(t, err)
+	values := make([]float64, 0)
+	for _, o := range observations {
+		values = append(values, o.Value)
+	}
+	assert.Equal(t, []float64{10, 20, 30}, values)
+
+	// the range excludes from and includes to
+	observations, _ = s.Range("a", epoch.Add(10*time.Second), epoch.Add(20*time.Second))
+	assert.Len(t, observations, 1)
+
+	// adding trims the observations older than the retention
+	assert.NoError(t, s.Add("a", Observation{Time: epoch.Add(75 * time.Second)}))
+	observations, _ = s.Range("a", epoch, epoch.Add(2*time.Minute))
+	assert.Len(t, observations, 3)
+
+	assert.NoError(t, s.Add("b", Observation{Time: epoch}))
+	assert.Equal(t, 2, s.Series())
+	s.Prune(epoch.Add(2 * time.Minute))
+	assert.Equal(t, 1, s.Series())
+	s.Prune(epoch.Add(3 * time.Minute))
+	assert.Equal(t, 0, s.Series())
+
+	// a store without retention keeps the observations for DefaultRetention
+	s = NewMemoryStore(0)
+	assert.NoError(t, s.Add("a", Observation{Time: epoch}))
+	observations, _ = s.Range("a", epoch.Add(-time.Minute), epoch)
+	assert.Len(t, observations, 1)
+}
+
+func TestPipelineAggregation(t *testing.T) {
+	en, a := newEngine(t, NewMemoryStore(time.Hour))
+	r, err := en.NewRule(`count_over(list(action, user), "10m") > 5`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := evaluator.NewRuleSet()
+	rs.Add(r)
+
+	// events carry their time, the failed logins of user 1 are a minute apart
+	p := pipeline.New(rs, pipeline.Options{
+		Workers: 1,
+		EventContext: func(ctx context.Context, event map[string]interface{}) context.Context {
+			return a.Observe(ctx, event["time"].(time.Time))
+		},
+	})
+
+	var mtx sync.Mutex
+	alerts := make([]int, 0)
+	p.Subscribe(pipeline.SubscriberFunc(func(m pipeline.Match) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		alerts = append(alerts, m.Event["id"].(int))
+		return nil
+	}))
+	p.Start()
+
+	for i := 0; i < 8; i++ {
+		event := map[string]interface{}{"id": i, "user": 1, "action": "login_failed", "time": epoch.Add(time.Duration(i) * time.Minute)}
+		assert.NoError(t, p.Publish(context.Background(), event))
+	}
+	// another action of the same user is counted apart
+	assert.NoError(t, p.Publish(context.Background(), map[string]interface{}{"id": 8, "user": 1, "action": "login", "time": epoch.Add(8 * time.Minute)}))
+	assert.NoError(t, p.Shutdown(context.Background()))
+
+	assert.Equal(t, []int{5, 6, 7}, alerts)
+}
@@ -0,0 +1,125 @@
+package aggregate
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Observation is a value recorded in a series at a point in time
+type Observation struct {
+	Time  time.Time
+	Value float64 // summed by sum_over
+	Label string  // counted once by distinct_over
+}
+
+// Store keeps the series of observations of the aggregate functions. It is
+// called concurrently by the evaluations
+type Store interface {
+	// Add records obs in series
+	Add(series string, obs Observation) error
+	// Range RETURNS the observations of series in (from, to], oldest first
+	Range(series string, from, to time.Time) ([]Observation, error)
+}
+
+// MemoryStore is a Store of sliding windows kept in memory. Observations
+// older than the retention are dropped, so windows longer than it see
+// only the retained observations
+type MemoryStore struct {
+	mtx       *sync.Mutex
+	series    map[string][]Observation
+	retention time.Duration
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// DefaultRetention is the retention of a MemoryStore created without one
+const DefaultRetention = 24 * time.Hour
+
+// NewMemoryStore RETURNS a store retaining the observations for retention,
+// DefaultRetention when it is not positive
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	return &MemoryStore{
+		mtx:       &sync.Mutex{},
+		series:    make(map[string][]Observation),
+		retention: retention,
+	}
+}
+
+func (s *MemoryStore) Add(series string, obs Observation) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	observations := s.series[series]
+	// events can arrive slightly out of order, keep the series sorted
+	i := sort.Search(len(observations), func(i int) bool {
+		return observations[i].Time.After(obs.Time)
+	})
+	observations = append(observations, Observation{})
+	copy(observations[i+1:], observations[i:])
+	observations[i] = obs
+
+	s.series[series] = expire(observations, obs.Time.Add(-s.retention))
+	return nil
+}
+
+func (s *MemoryStore) Range(series string, from, to time.Time) ([]Observation, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	observations := s.series[series]
+	start := sort.Search(len(observations), func(i int) bool {
+		return observations[i].Time.After(from)
+	})
+	end := sort.Search(len(observations), func(i int) bool {
+		return observations[i].Time.After(to)
+	})
+	if start >= end {
+		return nil, nil
+	}
+
+	r := make([]Observation, end-start)
+	copy(r, observations[start:end])
+	return r, nil
+}
+
+// Prune drops the observations older than the retention at now, and the
+// series left empty. Series are otherwise only trimmed when added to
+func (s *MemoryStore) Prune(now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for name, observations := range s.series {
+		observations = expire(observations, now.Add(-s.retention))
+		if len(observations) == 0 {
+			delete(s.series, name)
+			continue
+		}
+		s.series[name] = observations
+	}
+}
+
+// Series RETURNS the number of series held
+func (s *MemoryStore) Series() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.series)
+}
+
+// expire drops the observations at or before cutoff
+func expire(observations []Observation, cutoff time.Time) []Observation {
+	i := sort.Search(len(observations), func(i int) bool {
+		return observations[i].Time.After(cutoff)
+	})
+	if i == 0 {
+		return observations
+	}
+
+	// copy so the backing array doesn't grow forever
+	return append([]Observation(nil), observations[i:]...)
+}
@@ -0,0 +1,285 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+// ErrStop can be returned by the result callback of Run to stop the batch
+// early without failing it
+var ErrStop = errors.New("batch stopped")
+
+// Iterator yields the inputs of a batch, Next RETURNS false once the inputs
+// are exhausted. It is only called from one goroutine
+type Iterator interface {
+	Next() (map[string]interface{}, bool)
+}
+
+// IteratorFunc adapts a function to the Iterator interface
+type IteratorFunc func() (map[string]interface{}, bool)
+
+func (f IteratorFunc) Next() (map[string]interface{}, bool) { return f() }
+
+// SliceIterator iterates over inputs
+func SliceIterator(inputs []map[string]interface{}) Iterator {
+	i := 0
+	return IteratorFunc(func() (map[string]interface{}, bool) {
+		if i == len(inputs) {
+			return nil, false
+		}
+		i++
+		return inputs[i-1], true
+	})
+}
+
+// Rules is a collection of rules evaluated against every input, like
+// evaluator.RuleSet, rete.Network or index.Index
+type Rules interface {
+	Eval(params map[string]interface{}) []*evaluator.Rule
+}
+
+// ContextRules is implemented by the collections reporting evaluation
+// errors, like evaluator.RuleSet and index.Index, they are used instead of
+// Eval when available. Only they report the inputs failing to evaluate, with
+// other collections like rete.Network such inputs just match no rule
+type ContextRules interface {
+	EvalContext(ctx context.Context, params map[string]interface{}) ([]*evaluator.Rule, error)
+}
+
+// Options configures a batch
+type Options struct {
+	// evaluating goroutines, GOMAXPROCS when zero
+	Workers int
+	// results are delivered as soon as they are ready instead of in input order
+	Unordered bool
+	// inputs in flight, bounds the results held back to restore the order.
+	// 4 per worker when zero
+	Window int
+	// stop the batch at the first input failing to evaluate
+	StopOnError bool
+}
+
+// Result is the outcome of the evaluation of one input
+type Result struct {
+	Index   int // position of the input in the iterator
+	Input   map[string]interface{}
+	Matched []*evaluator.Rule
+	Err     error
+}
+
+// ItemError is returned by Run when StopOnError is set and an input fails
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("input %d: %s", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+type job struct {
+	index int
+	input map[string]interface{}
+}
+
+// Run evaluates every input of it against rules with a pool of workers and
+// calls fn with each result, from the calling goroutine. Results come in
+// input order unless opts.Unordered is set. The batch stops early when ctx
+// is done, when fn RETURNS an error or when an input fails with
+// opts.StopOnError. Returning ErrStop from fn stops the batch without error
+func Run(ctx context.Context, it Iterator, rules Rules, opts Options, fn func(Result) error) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	window := opts.Window
+	if window <= 0 {
+		window = 4 * workers
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job)
+	results := make(chan Result, window)
+	// one slot per input in flight, freed once its result is delivered
+	slots := make(chan struct{}, window)
+
+	var producerErr error
+	go func() {
+		defer close(jobs)
+
+		for i := 0; ; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			input, ok := next(it)
+			if !ok {
+				return
+			}
+			if input.err != nil {
+				producerErr = input.err
+				cancel()
+				return
+			}
+
+			select {
+			case jobs <- job{index: i, input: input.params}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				select {
+				case results <- evaluate(ctx, rules, j):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	err := deliver(results, slots, opts, fn)
+	cancel()
+	for range results {
+		// let the workers exit
+	}
+
+	switch {
+	case err == ErrStop:
+		return nil
+	case err != nil:
+		return err
+	case producerErr != nil:
+		return producerErr
+	default:
+		return parent.Err()
+	}
+}
+
+// deliver passes the results to fn, restoring the input order unless unordered
+func deliver(results <-chan Result, slots <-chan struct{}, opts Options, fn func(Result) error) error {
+	pending := make(map[int]Result)
+	expected := 0
+
+	emit := func(r Result) error {
+		<-slots
+		if r.Err != nil && opts.StopOnError {
+			if err := fn(r); err != nil {
+				return err
+			}
+			return &ItemError{Index: r.Index, Err: r.Err}
+		}
+		return fn(r)
+	}
+
+	for r := range results {
+		if opts.Unordered {
+			if err := emit(r); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pending[r.Index] = r
+		for {
+			r, ok := pending[expected]
+			if !ok {
+				break
+			}
+			delete(pending, expected)
+			expected++
+
+			if err := emit(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type item struct {
+	params map[string]interface{}
+	err    error
+}
+
+// next reads the next input, turning a panicking iterator into an error
+func next(it Iterator) (in item, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			in, ok = item{err: fmt.Errorf("iterator panicked: %v", r)}, true
+		}
+	}()
+
+	params, ok := it.Next()
+	return item{params: params}, ok
+}
+
+func evaluate(ctx context.Context, rules Rules, j job) (res Result) {
+	res = Result{Index: j.index, Input: j.input}
+	defer func() {
+		if r := recover(); r != nil {
+			res.Matched, res.Err = nil, fmt.Errorf("evaluation panicked: %v", r)
+		}
+	}()
+
+	if cr, ok := rules.(ContextRules); ok {
+		res.Matched, res.Err = cr.EvalContext(ctx, j.input)
+		return res
+	}
+
+	res.Matched = rules.Eval(j.input)
+	return res
+}
+
+// Collect runs the batch and RETURNS every result in input order
+func Collect(ctx context.Context, it Iterator, rules Rules, opts Options) ([]Result, error) {
+	opts.Unordered = false
+
+	collected := make([]Result, 0)
+	err := Run(ctx, it, rules, opts, func(r Result) error {
+		collected = append(collected, r)
+		return nil
+	})
+
+	return collected, err
+}
+
+// Errors RETURNS the results that failed to evaluate
+func Errors(results []Result) []Result {
+	failed := make([]Result, 0)
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,163 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/index"
+)
+
+func ruleSet(t testing.TB, exprs ...string) *evaluator.RuleSet {
+	rs := evaluator.NewRuleSet()
+	for _, expr := range exprs {
+		r, err := evaluator.NewRule(expr, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+func inputs(n int) []map[string]interface{} {
+	in := make([]map[string]interface{}, n)
+	for i := range in {
+		in[i] = map[string]interface{}{"amount": i, "country": []string{"DE", "FR"}[i%2]}
+	}
+
+	return in
+}
+
+func TestCollectOrdered(t *testing.T) {
+	rs := ruleSet(t, `amount >= 500`, `country == "DE"`)
+
+	for _, workers := range []int{1, 3, 16} {
+		results, err := Collect(context.Background(), SliceIterator(inputs(1000)), rs, Options{Workers: workers, Window: 8})
+		if !assert.NoError(t, err) || !assert.Len(t, results, 1000) {
+			continue
+		}
+
+		for i, r := range results {
+			assert.Equal(t, i, r.Index)
+			assert.NoError(t, r.Err)
+			expected := 0
+			if i >= 500 {
+				expected++
+			}
+			if i%2 == 0 {
+				expected++
+			}
+			assert.Len(t, r.Matched, expected, fmt.Sprintf("workers %d, input %d", workers, i))
+		}
+	}
+}
+
+func TestRunUnordered(t *testing.T) {
+	rs := ruleSet(t, `amount >= 50`)
+
+	seen := make([]int, 0)
+	err := Run(context.Background(), SliceIterator(inputs(100)), rs, Options{Workers: 4, Unordered: true}, func(r Result) error {
+		seen = append(seen, r.Index)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	sort.Ints(seen)
+	for i := range seen {
+		assert.Equal(t, i, seen[i])
+	}
+}
+
+func TestEarlyTermination(t *testing.T) {
+	rs := ruleSet(t, `amount >= 50`)
+
+	// the callback stops the batch
+	var read int32
+	it := IteratorFunc(func() (map[string]interface{}, bool) {
+		n := atomic.AddInt32(&read, 1)
+		return map[string]interface{}{"amount": int(n)}, true
+	})
+
+	delivered := 0
+	err := Run(context.Background(), it, rs, Options{Workers: 2, Window: 4}, func(r Result) error {
+		delivered++
+		if delivered == 10 {
+			return ErrStop
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, delivered)
+	assert.LessOrEqual(t, int(atomic.LoadInt32(&read)), 10+4+1)
+
+	// a cancelled context stops the batch
+	ctx, cancel := context.WithCancel(context.Background())
+	delivered = 0
+	err = Run(ctx, it, rs, Options{Workers: 2}, func(r Result) error {
+		delivered++
+		if delivered == 5 {
+			cancel()
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// callback errors are returned
+	boom := errors.New("boom")
+	err = Run(context.Background(), it, rs, Options{}, func(r Result) error { return boom })
+	assert.Equal(t, boom, err)
+}
+
+func TestItemErrors(t *testing.T) {
+	rs := ruleSet(t, `amount > 10`)
+	in := []map[string]interface{}{{"amount": 20}, {}, {"amount": 5}, {"country": "DE"}}
+
+	results, err := Collect(context.Background(), SliceIterator(in), rs, Options{Workers: 2})
+	assert.NoError(t, err)
+	failed := Errors(results)
+	if assert.Len(t, failed, 2) {
+		assert.Equal(t, 1, failed[0].Index)
+		assert.Equal(t, 3, failed[1].Index)
+		assert.Contains(t, failed[0].Err.Error(), "identifier not found: amount")
+	}
+
+	results, err = Collect(context.Background(), SliceIterator(in), rs, Options{Workers: 2, StopOnError: true})
+	var ie *ItemError
+	if assert.True(t, errors.As(err, &ie)) {
+		assert.Equal(t, 1, ie.Index)
+	}
+	assert.Len(t, results, 2)
+
+	// the index reports the failing inputs too
+	results, err = Collect(context.Background(), SliceIterator(in), index.New(rs), Options{Workers: 2})
+	assert.NoError(t, err)
+	failed = Errors(results)
+	if assert.Len(t, failed, 2) {
+		assert.Equal(t, 1, failed[0].Index)
+		assert.Contains(t, failed[0].Err.Error(), "identifier not found: amount")
+	}
+
+	// panicking iterators fail the batch
+	_, err = Collect(context.Background(), IteratorFunc(func() (map[string]interface{}, bool) { panic("broken") }), rs, Options{})
+	assert.EqualError(t, err, "iterator panicked: broken")
+}
+
+func BenchmarkRun(b *testing.B) {
+	rs := ruleSet(b, `amount >= 500 and country == "DE"`, `country in list("FR", "IT")`, `amount < 100`)
+	in := inputs(10000)
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = Run(context.Background(), SliceIterator(in), rs, Options{Workers: workers}, func(Result) error { return nil })
+			}
+		})
+	}
+}
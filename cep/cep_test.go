@@ -0,0 +1,284 @@
+package cep
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/queue"
+)
+
+// manualClock only moves forward when advanced
+type manualClock struct {
+	mtx     sync.Mutex
+	now     time.Time
+	waiters []*manualWaiter
+}
+
+type manualWaiter struct {
+	clock *manualClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop removes the waiter from the clock
+func (w *manualWaiter) Stop() bool {
+	w.clock.mtx.Lock()
+	defer w.clock.mtx.Unlock()
+
+	for i, other := range w.clock.waiters {
+		if other == w {
+			w.clock.waiters = append(w.clock.waiters[:i], w.clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *manualClock) NewTimer(d time.Duration) queue.Timer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	w := &manualWaiter{clock: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+func rule(t *testing.T, expr string) *evaluator.Rule {
+	r, err := evaluator.NewRule(expr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+type step struct {
+	advance time.Duration
+	event   map[string]interface{}
+	// "pattern:status:user" of the matches emitted by the step
+	matches []string
+}
+
+func describe(matches []Match) []string {
+	described := make([]string, 0)
+	for _, m := range matches {
+		described = append(described, fmt.Sprintf("%s:%s:%v", m.Pattern, m.Status, m.Key))
+	}
+	return described
+}
+
+func TestPatterns(t *testing.T) {
+	login := rule(t, `action == "login"`)
+	transfer := rule(t, `action == "transfer" and amount > 1000`)
+	checkout := rule(t, `action == "checkout"`)
+	pay := rule(t, `action == "pay"`)
+
+	tests := []struct {
+		patterns []*Pattern
+		steps    []step
+	}{
+		// a followed by b within 5 minutes for the same user
+		{
+			[]*Pattern{Sequence("login_transfer", 5*time.Minute, login, transfer).PartitionBy("user")},
+			[]step{
+				{0, map[string]interface{}{"user": "a", "action": "login", "amount": 0}, []string{}},
+				{time.Minute, map[string]interface{}{"user": "b", "action": "transfer", "amount": 5000}, []string{}},
+				{time.Minute, map[string]interface{}{"user": "a", "action": "transfer", "amount": 10}, []string{}},
+				{time.Minute, map[string]interface{}{"user": "a", "action": "transfer", "amount": 5000}, []string{"login_transfer:completed:[a]"}},
+				// completed runs are not matched again
+				{time.Minute, map[string]interface{}{"user": "a", "action": "transfer", "amount": 5000}, []string{}},
+			},
+		},
+		// incomplete sequences expire
+		{
+			[]*Pattern{Sequence("login_transfer", 5*time.Minute, login, transfer).PartitionBy("user")},
+			[]step{
+				{0, map[string]interface{}{"user": "a", "action": "login", "amount": 0}, []string{}},
+				{time.Minute, map[string]interface{}{"user": "b", "action": "login", "amount": 0}, []string{}},
+				{6 * time.Minute, map[string]interface{}{"user": "a", "action": "transfer", "amount": 5000}, []string{"login_transfer:expired:[a]", "login_transfer:expired:[b]"}},
+			},
+		},
+		// a not followed by b within 1 hour
+		{
+			[]*Pattern{Absence("abandoned", time.Hour, checkout, pay).PartitionBy("user")},
+			[]step{
+				{0, map[string]interface{}{"user": "a", "action": "checkout", "amount": 0}, []string{}},
+				{0, map[string]interface{}{"user": "b", "action": "checkout", "amount": 0}, []string{}},
+				{30 * time.Minute, map[string]interface{}{"user": "b", "action": "pay", "amount": 0}, []string{}},
+				{31 * time.Minute, map[string]interface{}{"user": "c", "action": "pay", "amount": 0}, []string{"abandoned:completed:[a]"}},
+			},
+		},
+		// every partition field must be present
+		{
+			[]*Pattern{Sequence("same_device", time.Minute, login, login).PartitionBy("user", "device")},
+			[]step{
+				{0, map[string]interface{}{"user": "a", "device": 1, "action": "login", "amount": 0}, []string{}},
+				{0, map[string]interface{}{"user": "a", "action": "login", "amount": 0}, []string{}},
+				{0, map[string]interface{}{"user": "a", "device": 2, "action": "login", "amount": 0}, []string{}},
+				{0, map[string]interface{}{"user": "a", "device": 1, "action": "login", "amount": 0}, []string{"same_device:completed:[a 1]"}},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+		p, err := New(clock, tt.patterns...)
+		if !assert.NoError(t, err, fmt.Sprintf("tests[%d]", i)) {
+			continue
+		}
+
+		for j, s := range tt.steps {
+			clock.Advance(s.advance)
+			matches, err := p.Process(context.Background(), s.event)
+			assert.NoError(t, err, fmt.Sprintf("tests[%d] steps[%d]", i, j))
+			assert.Equal(t, s.matches, describe(matches), fmt.Sprintf("tests[%d] steps[%d]", i, j))
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.Now()
+	p, _ := New(clock, Sequence("abc", time.Hour, rule(t, `n == 1`), rule(t, `n == 2`), rule(t, `n == 3`)))
+
+	for n := 1; n <= 3; n++ {
+		clock.Advance(time.Minute)
+		matches, err := p.Process(context.Background(), map[string]interface{}{"n": n})
+		assert.NoError(t, err)
+		if n < 3 {
+			assert.Empty(t, matches)
+			continue
+		}
+
+		assert.Equal(t, []Match{{
+			Pattern: "abc",
+			Status:  Completed,
+			Key:     []interface{}{},
+			Events:  []map[string]interface{}{{"n": 1}, {"n": 2}, {"n": 3}},
+			Start:   start.Add(time.Minute),
+			End:     start.Add(3 * time.Minute),
+		}}, matches)
+	}
+	assert.Equal(t, 0, p.Pending())
+}
+
+func TestRun(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p, _ := New(clock, Absence("abandoned", time.Hour, rule(t, `action == "checkout"`), rule(t, `action == "pay"`)).PartitionBy("user"))
+
+	_, _ = p.Process(context.Background(), map[string]interface{}{"user": "a", "action": "checkout"})
+	assert.Equal(t, 1, p.Pending())
+
+	matches := make(chan Match, 1)
+	done := make(chan error)
+	go func() {
+		done <- p.Run(context.Background(), func(m Match) { matches <- m })
+	}()
+
+	// expired without another event once the clock passes the deadline
+	for {
+		clock.mtx.Lock()
+		waiting := len(clock.waiters)
+		clock.mtx.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Hour)
+
+	m := <-matches
+	assert.Equal(t, "abandoned", m.Pattern)
+	assert.Equal(t, Completed, m.Status)
+	assert.Equal(t, clock.Now(), m.End)
+	assert.Equal(t, 0, p.Pending())
+
+	p.Close()
+	assert.NoError(t, <-done)
+}
+
+func TestErrors(t *testing.T) {
+	a := rule(t, `a == 1`)
+
+	_, err := New(nil, Sequence("", time.Minute, a))
+	assert.EqualError(t, err, "pattern name is required")
+	_, err = New(nil, Sequence("s", 0, a))
+	assert.EqualError(t, err, `pattern "s": window must be positive`)
+	_, err = New(nil, Sequence("s", time.Minute))
+	assert.EqualError(t, err, `pattern "s": no steps`)
+	_, err = New(nil, Absence("s", time.Minute, a, nil))
+	assert.EqualError(t, err, `pattern "s": absent condition is required`)
+	_, err = New(nil, Sequence("s", time.Minute, a), Sequence("s", time.Minute, a))
+	assert.EqualError(t, err, `duplicate pattern "s"`)
+
+	// a condition failing to evaluate is not met, the others still are
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	login := rule(t, `action == "login"`)
+	transfer := rule(t, `action == "transfer" and amount > 1000`)
+	p, _ := New(clock, Sequence("login_transfer", time.Minute, login, transfer).PartitionBy("user"))
+
+	matches, err := p.Process(context.Background(), map[string]interface{}{"user": "u", "action": "login"})
+	assert.EqualError(t, err, `pattern "login_transfer": eval: identifier not found: amount`)
+	assert.Empty(t, matches)
+	assert.Equal(t, 1, p.Pending())
+
+	matches, err = p.Process(context.Background(), map[string]interface{}{"user": "u", "action": "transfer", "amount": 5000})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"login_transfer:completed:[u]"}, describe(matches))
+}
+
+func TestTimers(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p, _ := New(clock,
+		Absence("slow", time.Hour, rule(t, `a == 1`), rule(t, `a == 2`)).PartitionBy("id"),
+		Absence("fast", time.Minute, rule(t, `a == 1`), rule(t, `a == 2`)).PartitionBy("id"),
+	)
+
+	// only the earliest deadline is waited for
+	for i := 0; i < 1000; i++ {
+		_, err := p.Process(context.Background(), map[string]interface{}{"id": i, "a": 1})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2000, p.Pending())
+	assert.Equal(t, 2, p.timers.Length())
+
+	// without Run, expiring drops the wake-ups due and schedules the next
+	clock.Advance(time.Minute)
+	assert.Len(t, p.Advance(), 1000)
+	assert.Equal(t, 1, p.timers.Length())
+
+	clock.Advance(time.Hour)
+	assert.Len(t, p.Advance(), 1000)
+	assert.Equal(t, 0, p.timers.Length())
+	assert.Equal(t, 0, p.Pending())
+}
@@ -0,0 +1,111 @@
+// Package cep detects temporal patterns across events, composed from the
+// conditions of rules:
+//
+//	Sequence("escalation", 5*time.Minute, a, b)  a followed by b within 5m
+//	Absence("abandoned", time.Hour, a, b)        a not followed by b within 1h
+//
+// Patterns are tracked per partition, e.g. per user, and their windows
+// start at the first matching event.
+package cep
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+type kind int
+
+const (
+	sequence kind = iota
+	absence
+)
+
+// Pattern is a temporal pattern over the events of a partition
+type Pattern struct {
+	name   string
+	kind   kind
+	within time.Duration
+	// conditions of the sequence, or the trigger of an absence
+	steps []*evaluator.Rule
+	// condition cancelling an absence
+	absent *evaluator.Rule
+	// fields of the events keying the partitions, one partition when empty
+	partition []string
+}
+
+// Sequence RETURNS a pattern matching events meeting the conditions of
+// steps one after the other, all within the window. Every event meeting
+// the first step starts a new attempt, attempts left incomplete expire
+func Sequence(name string, within time.Duration, steps ...*evaluator.Rule) *Pattern {
+	return &Pattern{name: name, kind: sequence, within: within, steps: steps}
+}
+
+// Absence RETURNS a pattern matching an event meeting trigger that is not
+// followed by an event meeting absent within the window. It completes when
+// the window expires
+func Absence(name string, within time.Duration, trigger, absent *evaluator.Rule) *Pattern {
+	return &Pattern{name: name, kind: absence, within: within, steps: []*evaluator.Rule{trigger}, absent: absent}
+}
+
+// PartitionBy RETURNS a copy of the pattern tracked separately for each
+// value of fields. Events missing one of the fields are ignored
+func (p *Pattern) PartitionBy(fields ...string) *Pattern {
+	c := *p
+	c.partition = append([]string(nil), fields...)
+	return &c
+}
+
+// Name RETURNS the name of the pattern
+func (p *Pattern) Name() string {
+	return p.name
+}
+
+func (p *Pattern) validate() error {
+	switch {
+	case p.name == "":
+		return errors.New("pattern name is required")
+	case p.within <= 0:
+		return fmt.Errorf("pattern %q: window must be positive", p.name)
+	case len(p.steps) == 0:
+		return fmt.Errorf("pattern %q: no steps", p.name)
+	case p.kind == absence && p.absent == nil:
+		return fmt.Errorf("pattern %q: absent condition is required", p.name)
+	}
+
+	for i, s := range p.steps {
+		if s == nil {
+			return fmt.Errorf("pattern %q: step %d has no rule", p.name, i)
+		}
+	}
+
+	return nil
+}
+
+// rules RETURNS the conditions of the pattern
+func (p *Pattern) rules() []*evaluator.Rule {
+	if p.absent != nil {
+		return append(append([]*evaluator.Rule(nil), p.steps...), p.absent)
+	}
+	return p.steps
+}
+
+// key RETURNS the values of the partition fields of event and the string
+// identifying the partition, ok is false when a field is missing
+func (p *Pattern) key(event map[string]interface{}) ([]interface{}, string, bool) {
+	values := make([]interface{}, 0, len(p.partition))
+	parts := make([]string, 0, len(p.partition))
+	for _, field := range p.partition {
+		v, ok := event[field]
+		if !ok || v == nil {
+			return nil, "", false
+		}
+		values = append(values, v)
+		parts = append(parts, fmt.Sprint(v))
+	}
+
+	return values, strings.Join(parts, "\x1f"), true
+}
@@ -0,0 +1,315 @@
+package cep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/queue"
+)
+
+// Status tells how a pattern ended
+type Status string
+
+const (
+	// the sequence met all its steps, or the absence window elapsed
+	// without the absent event
+	Completed Status = "completed"
+	// the sequence window elapsed before all its steps were met
+	Expired Status = "expired"
+)
+
+// Match is emitted when a pattern completes or expires
+type Match struct {
+	Pattern string
+	Status  Status
+	// values of the partition fields
+	Key []interface{}
+	// events that met the steps, in order
+	Events []map[string]interface{}
+	Start  time.Time // time of the first event
+	End    time.Time // time of the completion or of the expiry
+}
+
+// run is an attempt at a pattern in one partition
+type run struct {
+	seq      uint64
+	key      []interface{}
+	events   []map[string]interface{}
+	start    time.Time
+	deadline time.Time
+}
+
+// Processor feeds events to patterns. It is safe for concurrent use, the
+// events are processed in the order Process is called
+type Processor struct {
+	mtx      *sync.Mutex
+	clock    queue.Clock
+	patterns []*Pattern
+	// runs of every pattern by partition
+	runs map[*Pattern]map[string][]*run
+	seq  uint64
+
+	// wakes up Run at the earliest deadline of the runs, wake is the
+	// earliest wake-up queued, zero when none is
+	timers *queue.DelayQueue[struct{}]
+	wake   time.Time
+}
+
+// New RETURNS a processor of patterns timed by clock, the system clock when nil
+func New(clock queue.Clock, patterns ...*Pattern) (*Processor, error) {
+	if clock == nil {
+		clock = queue.SystemClock
+	}
+
+	names := make(map[string]bool, len(patterns))
+	runs := make(map[*Pattern]map[string][]*run, len(patterns))
+	for _, p := range patterns {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if names[p.name] {
+			return nil, fmt.Errorf("duplicate pattern %q", p.name)
+		}
+		names[p.name] = true
+		runs[p] = make(map[string][]*run)
+	}
+
+	return &Processor{
+		mtx:      &sync.Mutex{},
+		clock:    clock,
+		patterns: patterns,
+		runs:     runs,
+		timers:   queue.NewDelay[struct{}](clock),
+	}, nil
+}
+
+// Process evaluates the conditions of the patterns against event, which
+// happens now, and RETURNS the matches it completes along with the ones
+// expired until now. A condition failing to evaluate, e.g. on a field the
+// event lacks, is not met: the event still goes through the patterns and
+// the error of the first failing condition is returned with the matches
+func (p *Processor) Process(ctx context.Context, event map[string]interface{}) ([]Match, error) {
+	met, err := p.evaluate(ctx, event)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.clock.Now()
+	matches := p.expire(now)
+	for _, pat := range p.patterns {
+		key, partition, ok := pat.key(event)
+		if !ok {
+			continue
+		}
+
+		switch pat.kind {
+		case sequence:
+			matches = append(matches, p.advance(pat, partition, event, met, now)...)
+		case absence:
+			if met[pat.absent] {
+				delete(p.runs[pat], partition)
+			}
+		}
+
+		if !met[pat.steps[0]] {
+			continue
+		}
+		r := p.start(pat, partition, key, event, now)
+		if pat.kind == sequence && len(pat.steps) == 1 {
+			matches = append(matches, p.complete(pat, partition, r, Completed, now))
+		}
+	}
+
+	return matches, err
+}
+
+// Advance RETURNS the matches expired until now
+func (p *Processor) Advance() []Match {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.expire(p.clock.Now())
+}
+
+// Run calls fn with the matches expiring over time until ctx is done or
+// the processor is closed, from the calling goroutine
+func (p *Processor) Run(ctx context.Context, fn func(Match)) error {
+	for {
+		if _, err := p.timers.Dequeue(ctx); err == queue.ErrClosed {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, m := range p.Advance() {
+			fn(m)
+		}
+	}
+}
+
+// Close stops Run, the runs in progress are not expired anymore
+func (p *Processor) Close() {
+	p.timers.Close()
+}
+
+// Pending RETURNS the number of runs in progress
+func (p *Processor) Pending() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	n := 0
+	for _, partitions := range p.runs {
+		for _, runs := range partitions {
+			n += len(runs)
+		}
+	}
+
+	return n
+}
+
+// evaluate RETURNS the conditions of the patterns met by event, each rule
+// is evaluated once, and the error of the first one failing
+func (p *Processor) evaluate(ctx context.Context, event map[string]interface{}) (map[*evaluator.Rule]bool, error) {
+	var first error
+	met := make(map[*evaluator.Rule]bool)
+	evaluated := make(map[*evaluator.Rule]bool)
+	for _, pat := range p.patterns {
+		for _, r := range pat.rules() {
+			if evaluated[r] {
+				continue
+			}
+			evaluated[r] = true
+
+			ok, err := r.EvalContext(ctx, event)
+			if err != nil && first == nil {
+				first = fmt.Errorf("pattern %q: %w", pat.name, err)
+			}
+			met[r] = ok && err == nil
+		}
+	}
+
+	return met, first
+}
+
+// advance moves the runs of the partition waiting for a step met by event
+func (p *Processor) advance(pat *Pattern, partition string, event map[string]interface{}, met map[*evaluator.Rule]bool, now time.Time) []Match {
+	matches := make([]Match, 0)
+	for _, r := range append([]*run(nil), p.runs[pat][partition]...) {
+		if !met[pat.steps[len(r.events)]] {
+			continue
+		}
+
+		r.events = append(r.events, event)
+		if len(r.events) == len(pat.steps) {
+			matches = append(matches, p.complete(pat, partition, r, Completed, now))
+		}
+	}
+
+	return matches
+}
+
+func (p *Processor) start(pat *Pattern, partition string, key []interface{}, event map[string]interface{}, now time.Time) *run {
+	p.seq++
+	r := &run{
+		seq:      p.seq,
+		key:      key,
+		events:   []map[string]interface{}{event},
+		start:    now,
+		deadline: now.Add(pat.within),
+	}
+	p.runs[pat][partition] = append(p.runs[pat][partition], r)
+	p.schedule(r.deadline)
+
+	return r
+}
+
+// schedule wakes Run up at deadline unless it is woken up earlier already
+func (p *Processor) schedule(deadline time.Time) {
+	if !p.wake.IsZero() && !deadline.Before(p.wake) {
+		return
+	}
+
+	p.wake = deadline
+	_ = p.timers.Schedule(struct{}{}, deadline)
+}
+
+// complete removes r from its partition and RETURNS its match
+func (p *Processor) complete(pat *Pattern, partition string, r *run, status Status, end time.Time) Match {
+	runs := p.runs[pat][partition]
+	for i, other := range runs {
+		if other == r {
+			runs = append(runs[:i:i], runs[i+1:]...)
+			break
+		}
+	}
+	if len(runs) == 0 {
+		delete(p.runs[pat], partition)
+	} else {
+		p.runs[pat][partition] = runs
+	}
+
+	return Match{Pattern: pat.name, Status: status, Key: r.key, Events: r.events, Start: r.start, End: end}
+}
+
+// expire RETURNS the matches of the runs whose deadline passed at now, in
+// deadline order
+func (p *Processor) expire(now time.Time) []Match {
+	type expired struct {
+		match Match
+		seq   uint64
+	}
+
+	// the wake-ups due are dropped, whether Run consumed them or not
+	for {
+		if _, ok := p.timers.TryDequeue(); !ok {
+			break
+		}
+	}
+	p.wake = time.Time{}
+	if at, ok := p.timers.Next(); ok {
+		p.wake = at
+	}
+
+	var next time.Time
+	due := make([]expired, 0)
+	for _, pat := range p.patterns {
+		status := Expired
+		if pat.kind == absence {
+			status = Completed
+		}
+
+		for partition, runs := range p.runs[pat] {
+			for _, r := range runs {
+				if r.deadline.After(now) {
+					if next.IsZero() || r.deadline.Before(next) {
+						next = r.deadline
+					}
+					continue
+				}
+				due = append(due, expired{match: p.complete(pat, partition, r, status, r.deadline), seq: r.seq})
+			}
+		}
+	}
+
+	if !next.IsZero() {
+		p.schedule(next)
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].match.End.Equal(due[j].match.End) {
+			return due[i].match.End.Before(due[j].match.End)
+		}
+		return due[i].seq < due[j].seq
+	})
+
+	matches := make([]Match, len(due))
+	for i, d := range due {
+		matches[i] = d.match
+	}
+
+	return matches
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+)
+
+// maximum number of lines loaded from the history file
+const maxHistory = 1000
+
+// history keeps the entered lines in a file, one per line, so they are
+// available to the next sessions
+type history struct {
+	f     *os.File
+	lines []string
+}
+
+// openHistory loads the last lines of the file, creating it when missing
+func openHistory(path string) (*history, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+
+	return &history{f: f, lines: lines}, nil
+}
+
+// Add records line unless it repeats the previous one
+func (h *history) Add(line string) error {
+	if len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return nil
+	}
+	if h.f == nil {
+		return errors.New("history closed")
+	}
+
+	h.lines = append(h.lines, line)
+	_, err := h.f.WriteString(line + "\n")
+	return err
+}
+
+// Lines RETURNS the lines of the previous sessions and of this one, oldest first
+func (h *history) Lines() []string {
+	return h.lines
+}
+
+func (h *history) Close() error {
+	if h.f == nil {
+		return nil
+	}
+
+	err := h.f.Close()
+	h.f = nil
+	return err
+}
@@ -0,0 +1,291 @@
+// Command repl evaluates rule expressions entered interactively against
+// bindings loaded from a JSON file.
+//
+//	repl [-bindings file] [-lists dir] [-history file]
+//
+// Every line is an expression, its result is printed, or a command:
+//
+//	:set name value   bind name to value, a JSON value or else a string
+//	:unset name       remove the binding of name
+//	:load file        add the bindings of a JSON file
+//	:bindings         print the bindings
+//	:explain expr     print the evaluation trace of expr
+//	:ast expr         print the syntax tree of expr
+//	:tokens expr      print the tokens of expr
+//	:history          print the entered lines
+//	:help             print the commands
+//	:quit             exit, like end of input
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/loader"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+const (
+	prompt = "> "
+	help   = `:set name value   bind name to value, a JSON value or else a string
+:unset name       remove the binding of name
+:load file        add the bindings of a JSON file
+:bindings         print the bindings
+:explain expr     print the evaluation trace of expr
+:ast expr         print the syntax tree of expr
+:tokens expr      print the tokens of expr
+:history          print the entered lines
+:help             print the commands
+:quit             exit
+`
+)
+
+var errQuit = errors.New("quit")
+
+func main() {
+	bindings := flag.String("bindings", "", "load the bindings of the JSON `file`")
+	lists := flag.String("lists", "", "read the lists from the .txt files of `dir`")
+	historyFile := flag.String("history", ".rule_history", "keep the entered lines in `file`, none when empty")
+	flag.Parse()
+
+	r := newREPL(os.Stdout)
+	if *lists != "" {
+		r.lists = evaluator.NewFileListProvider(*lists)
+	}
+	if *bindings != "" {
+		if err := r.load(*bindings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *historyFile != "" {
+		h, err := openHistory(*historyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer h.Close()
+		r.history = h
+	}
+
+	r.run(os.Stdin)
+}
+
+type repl struct {
+	out      io.Writer
+	engine   *evaluator.Engine
+	bindings map[string]interface{}
+	lists    evaluator.ListProvider
+	history  *history
+}
+
+func newREPL(out io.Writer) *repl {
+	return &repl{
+		out:      out,
+		engine:   evaluator.NewEngine(),
+		bindings: make(map[string]interface{}),
+	}
+}
+
+// run reads lines from in until its end or :quit
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(r.out, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if r.history != nil {
+			if err := r.history.Add(line); err != nil {
+				fmt.Fprintf(r.out, "error: history: %s\n", err)
+			}
+		}
+
+		err := r.exec(line)
+		if err == errQuit {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", err)
+		}
+	}
+}
+
+// exec runs a command or evaluates an expression
+func (r *repl) exec(line string) error {
+	if !strings.HasPrefix(line, ":") {
+		return r.eval(line, false)
+	}
+
+	cmd, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch cmd {
+	case ":set":
+		return r.set(arg)
+	case ":unset":
+		delete(r.bindings, arg)
+		return nil
+	case ":load":
+		return r.load(arg)
+	case ":bindings":
+		r.printBindings()
+		return nil
+	case ":explain":
+		return r.eval(arg, true)
+	case ":ast":
+		rule, err := parse(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(r.out, parser.Tree(rule))
+		return nil
+	case ":tokens":
+		r.printTokens(arg)
+		return nil
+	case ":history":
+		r.printHistory()
+		return nil
+	case ":help":
+		fmt.Fprint(r.out, help)
+		return nil
+	case ":quit", ":q":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %s, see :help", cmd)
+	}
+}
+
+func (r *repl) eval(expression string, explain bool) error {
+	rule, err := parse(expression)
+	if err != nil {
+		return err
+	}
+
+	env := evaluator.NewEnvironment(r.bindings)
+	env.SetListProvider(r.lists)
+
+	if !explain {
+		fmt.Fprintln(r.out, inspect(r.engine.Eval(rule, env)))
+		return nil
+	}
+
+	result, trace := evaluator.Explain(rule, env)
+	fmt.Fprintln(r.out, inspect(result))
+	fmt.Fprint(r.out, trace)
+	return nil
+}
+
+func inspect(obj evaluator.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+// set binds "name value", the value is decoded as JSON when it is valid
+// JSON and taken as a string otherwise
+func (r *repl) set(arg string) error {
+	name, raw := arg, ""
+	if i := strings.IndexAny(arg, " \t"); i >= 0 {
+		name, raw = arg[:i], strings.TrimSpace(arg[i+1:])
+	}
+	if name == "" || raw == "" {
+		return errors.New("usage: :set name value")
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		r.bindings[name] = raw
+		return nil
+	}
+
+	value, err := loader.ParamValue(decoded)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	r.bindings[name] = value
+	return nil
+}
+
+func (r *repl) load(file string) error {
+	if file == "" {
+		return errors.New("usage: :load file")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bindings, err := loader.DecodeParams(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for name, value := range bindings {
+		r.bindings[name] = value
+	}
+
+	return nil
+}
+
+func (r *repl) printBindings() {
+	names := make([]string, 0, len(r.bindings))
+	for name := range r.bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, _ := json.Marshal(r.bindings[name])
+		fmt.Fprintf(r.out, "%s = %s\n", name, b)
+	}
+}
+
+func (r *repl) printTokens(expression string) {
+	l := parser.NewLexer(expression)
+	for tok := l.NextToken(); tok.Type != parser.EOF; tok = l.NextToken() {
+		fmt.Fprintf(r.out, "%-12s %q\n", tok.Type, tok.Literal)
+	}
+}
+
+func (r *repl) printHistory() {
+	if r.history == nil {
+		return
+	}
+
+	for i, line := range r.history.Lines() {
+		fmt.Fprintf(r.out, "%4d  %s\n", i+1, line)
+	}
+}
+
+func parse(expression string) (*parser.Rule, error) {
+	if expression == "" {
+		return nil, errors.New("empty expression")
+	}
+
+	p := parser.New(parser.NewLexer(expression))
+	rule := p.ParseRule()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	bindings := filepath.Join(dir, "bindings.json")
+	if err := os.WriteFile(bindings, []byte(`{"country": "DE", "amount": 150}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	r := newREPL(&out)
+	h, err := openHistory(filepath.Join(dir, "history"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer h.Close()
+	r.history = h
+
+	r.run(strings.NewReader(strings.Join([]string{
+		":load " + bindings,
+		`amount > 100 and country == "DE"`,
+		":set country FR",
+		":set tags [\"a\", \"b\"]",
+		`country == "DE" or "b" in tags`,
+		":set bad {\"a\": 1}",
+		":unset tags",
+		":bindings",
+		":explain amount - 50",
+		":ast a == 1",
+		":tokens r\"x\" in @l",
+		"amount ==",
+		":nope",
+		"",
+		":quit",
+		"amount",
+	}, "\n")))
+
+	expected := `> > true
+> > > true
+> error: bad: unsupported value map[string]interface {}
+> > amount = 150
+country = "FR"
+> 100.000000
+(amount - 50) => 100.000000
+  amount => 150.000000
+  50 => 50.000000
+> Rule
+  ExpressionStatement
+    InfixExpression ==
+      Identifier a
+      NumberLiteral 1
+> REGEX        "x"
+IN           "in"
+LISTNAME     "l"
+> error: no prefix parse function for EOF found
+> error: unknown command :nope, see :help
+> > `
+	assert.Equal(t, expected, out.String())
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := openHistory(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, h.Add("a == 1"))
+	// repeated lines are kept once
+	assert.NoError(t, h.Add("a == 1"))
+	assert.NoError(t, h.Add("b == 2"))
+	assert.NoError(t, h.Close())
+	assert.Error(t, h.Add("c == 3"))
+
+	// the next session starts with the lines of the previous ones
+	var out bytes.Buffer
+	r := newREPL(&out)
+	r.history, err = openHistory(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.history.Close()
+
+	r.run(strings.NewReader("3 == 3\n:history\n"))
+	assert.Equal(t, "> true\n>    1  a == 1\n   2  b == 2\n   3  3 == 3\n   4  :history\n> \n", out.String())
+}
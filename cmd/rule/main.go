@@ -0,0 +1,280 @@
+// Command rule evaluates, checks and formats rule expressions.
+//
+//	rule eval [-input file] [-lists dir] [-explain] (-f file | expression)
+//	rule check (-f file | expression)
+//	rule fmt [-w] (-f file | expression)
+//	rule info (-f file | expression)
+//	rule ast (-f file | expression)
+//
+// The input of eval is a JSON object read from stdin unless -input is set,
+// lists are read from the .txt files of -lists named after them.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/loader"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitFail  = 1 // the rule is invalid or failed to evaluate
+	exitUsage = 2
+)
+
+const usage = `usage: rule <command> [flags] (-f file | expression)
+
+commands:
+  eval   evaluate the rule against a JSON input and print the result
+  check  parse and type-check the rule, print the diagnostics
+  fmt    print the rule in canonical format
+  info   print the names and literals referenced by the rule as JSON
+  ast    print the syntax tree of the rule
+`
+
+var errUsage = errors.New("usage")
+
+type command func(args []string, stdin io.Reader, stdout io.Writer) (int, error)
+
+var commands = map[string]command{
+	"eval":  evalCmd,
+	"check": checkCmd,
+	"fmt":   fmtCmd,
+	"info":  infoCmd,
+	"ast":   astCmd,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "rule: unknown command %q\n%s", args[0], usage)
+		return exitUsage
+	}
+
+	code, err := cmd(args[1:], stdin, stdout)
+	switch {
+	case errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp):
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	case err != nil:
+		fmt.Fprintf(stderr, "rule %s: %s\n", args[0], err)
+	}
+
+	return code
+}
+
+// flags RETURNS the flag set of a command, writing the flag errors nowhere
+// since run prints the usage
+func flags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("f", "", "read the rule from `file`")
+
+	return fs, file
+}
+
+// expression RETURNS the rule given as argument or read from file
+func expression(fs *flag.FlagSet, file string) (string, error) {
+	switch {
+	case file != "" && fs.NArg() == 0:
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	case file == "" && fs.NArg() == 1:
+		return fs.Arg(0), nil
+	default:
+		return "", errUsage
+	}
+}
+
+// parse parses the expression, failing with the parse errors
+func parse(expression string) (*parser.Rule, error) {
+	p := parser.New(parser.NewLexer(expression))
+	rule := p.ParseRule()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	return rule, nil
+}
+
+func evalCmd(args []string, stdin io.Reader, stdout io.Writer) (int, error) {
+	fs, file := flags("eval")
+	input := fs.String("input", "-", "read the JSON input from `file`, - for stdin")
+	lists := fs.String("lists", "", "read the lists from the files of `dir`")
+	explain := fs.Bool("explain", false, "print the evaluation trace")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+
+	expr, err := expression(fs, *file)
+	if err != nil {
+		return exitUsage, err
+	}
+	r, err := evaluator.NewRule(expr, nil)
+	if err != nil {
+		return exitFail, err
+	}
+
+	params, err := readParams(*input, stdin)
+	if err != nil {
+		return exitFail, err
+	}
+
+	env := evaluator.NewEnvironment(params)
+	if *lists != "" {
+		env.SetListProvider(evaluator.NewFileListProvider(*lists))
+	}
+
+	// evaluated through Explain, which reports the errors and the result
+	// whatever its type
+	result, trace := evaluator.Explain(r.AST(), env)
+	if e, ok := result.(*evaluator.Error); ok {
+		return exitFail, errors.New(e.Message)
+	}
+	if result == nil {
+		return exitFail, errors.New("no result")
+	}
+
+	fmt.Fprintln(stdout, result.Inspect())
+	if *explain {
+		fmt.Fprint(stdout, trace)
+	}
+
+	return exitOK, nil
+}
+
+func readParams(input string, stdin io.Reader) (map[string]interface{}, error) {
+	if input == "-" {
+		return loader.DecodeParams(stdin)
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return loader.DecodeParams(f)
+}
+
+func checkCmd(args []string, _ io.Reader, stdout io.Writer) (int, error) {
+	fs, file := flags("check")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+
+	expr, err := expression(fs, *file)
+	if err != nil {
+		return exitUsage, err
+	}
+
+	diagnostics := evaluator.NewEngine().Check(expr)
+	for _, d := range diagnostics {
+		fmt.Fprintln(stdout, d)
+	}
+	if len(diagnostics) > 0 {
+		return exitFail, nil
+	}
+
+	return exitOK, nil
+}
+
+func fmtCmd(args []string, _ io.Reader, stdout io.Writer) (int, error) {
+	fs, file := flags("fmt")
+	write := fs.Bool("w", false, "write the result to the file of -f")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+
+	expr, err := expression(fs, *file)
+	if err != nil {
+		return exitUsage, err
+	}
+	if *write && *file == "" {
+		return exitUsage, errUsage
+	}
+
+	rule, err := parse(expr)
+	if err != nil {
+		return exitFail, err
+	}
+
+	formatted := parser.Format(rule)
+	if *write {
+		info, err := os.Stat(*file)
+		if err != nil {
+			return exitFail, err
+		}
+		return exitOK, os.WriteFile(*file, []byte(formatted+"\n"), info.Mode())
+	}
+
+	fmt.Fprintln(stdout, formatted)
+	return exitOK, nil
+}
+
+func infoCmd(args []string, _ io.Reader, stdout io.Writer) (int, error) {
+	fs, file := flags("info")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+
+	expr, err := expression(fs, *file)
+	if err != nil {
+		return exitUsage, err
+	}
+
+	p := parser.New(parser.NewLexer(expr))
+	info := p.Info()
+	if len(p.Errors()) > 0 {
+		return exitFail, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(info); err != nil {
+		return exitFail, err
+	}
+
+	return exitOK, nil
+}
+
+func astCmd(args []string, _ io.Reader, stdout io.Writer) (int, error) {
+	fs, file := flags("ast")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage, err
+	}
+
+	expr, err := expression(fs, *file)
+	if err != nil {
+		return exitUsage, err
+	}
+
+	rule, err := parse(expr)
+	if err != nil {
+		return exitFail, err
+	}
+
+	fmt.Fprint(stdout, parser.Tree(rule))
+	return exitOK, nil
+}
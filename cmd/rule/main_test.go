@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.json")
+	if err := os.WriteFile(input, []byte(`{"country": "DE", "amount": 150}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lists := filepath.Join(dir, "lists")
+	if err := os.Mkdir(lists, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lists, "eu.txt"), []byte("DE\nFR\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"eval", `amount > 100`}, `{"amount": 150}`, exitOK, "true\n", ""},
+		{[]string{"eval", "-input", input, `country == "FR"`}, "", exitOK, "false\n", ""},
+		{[]string{"eval", "-input", input, "-lists", lists, `country in @eu`}, "", exitOK, "true\n", ""},
+		{[]string{"eval", "-explain", `amount > 100`}, `{"amount": 150}`, exitOK, "true\n(amount > 100) => true\n  amount => 150.000000\n  100 => 100.000000\n", ""},
+		{[]string{"eval", `amount * 2`}, `{"amount": 1.5}`, exitOK, "3.000000\n", ""},
+		{[]string{"eval", `amount > 100`}, `{}`, exitFail, "", "rule eval: identifier not found: amount\n"},
+		{[]string{"eval", `amount >`}, `{}`, exitFail, "", "rule eval: no prefix parse function for EOF found\n"},
+		{[]string{"check", `amount > 100 and country == "DE"`}, "", exitOK, "", ""},
+		{[]string{"check", `amount + 1`}, "", exitFail, "amount + 1: rule evaluates to Number, not Boolean\n", ""},
+		{[]string{"check", `amount > 1 and "x"`}, "", exitFail, "amount > 1 and \"x\": operator and not defined on Boolean and String\n", ""},
+		{[]string{"fmt", `(a == 1) AND (b == 2 OR c)`}, "", exitOK, "a == 1 and (b == 2 or c)\n", ""},
+		{[]string{"fmt", `a ==`}, "", exitFail, "", "rule fmt: no prefix parse function for EOF found\n"},
+		{[]string{"ast", "--", `-a == 1`}, "", exitOK, "Rule\n  ExpressionStatement\n    InfixExpression ==\n      PrefixExpression -\n        Identifier a\n      NumberLiteral 1\n", ""},
+		{[]string{"info", `a == "x"`}, "", exitOK, `{
+  "calls": [],
+  "identifiers": [
+    "a"
+  ],
+  "lists": [],
+  "numbers": [],
+  "regexs": [],
+  "strings": [
+    "x"
+  ]
+}
+`, ""},
+		{[]string{}, "", exitUsage, "", usage},
+		{[]string{"eval"}, "", exitUsage, "", usage},
+		{[]string{"lint", "a"}, "", exitUsage, "", "rule: unknown command \"lint\"\n" + usage},
+		{[]string{"fmt", "-w", "a == 1"}, "", exitUsage, "", usage},
+	}
+
+	for i, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		assert.Equal(t, tt.code, code, fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.stdout, stdout.String(), fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.stderr, stderr.String(), fmt.Sprintf("tests[%d]", i))
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rule.txt")
+	if err := os.WriteFile(file, []byte("(a==1)  AND  b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"fmt", "-w", "-f", file}, nil, &stdout, &stderr))
+	assert.Empty(t, stdout.String())
+
+	b, _ := os.ReadFile(file)
+	assert.Equal(t, "a == 1 and b\n", string(b))
+}
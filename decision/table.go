@@ -0,0 +1,280 @@
+package decision
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// HitPolicy decides which of the matching rows make the result, modeled on DMN
+type HitPolicy string
+
+const (
+	Unique   HitPolicy = "UNIQUE"   // at most one row may match
+	First    HitPolicy = "FIRST"    // the first matching row in table order
+	Priority HitPolicy = "PRIORITY" // the matching row with the highest priority
+	Collect  HitPolicy = "COLLECT"  // every matching row in table order
+)
+
+const (
+	// header prefix of the output columns
+	OutputPrefix = "out:"
+	// header of the optional row priority column used by the PRIORITY policy
+	PriorityColumn = "#priority"
+	// cell matching any value
+	AnyValue = "-"
+)
+
+var ErrNotUnique = errors.New("more than one row matched")
+
+// Row is a compiled row of the table
+type Row struct {
+	Index      int // 1-based, the header is not counted
+	Conditions []string
+	Outputs    map[string]string
+	Priority   int
+
+	rule  *evaluator.Rule
+	cells []constraint
+}
+
+// Table is a decision table whose input columns are expressions and whose
+// cells are conditions on those expressions
+type Table struct {
+	Policy  HitPolicy
+	Inputs  []string
+	Outputs []string
+	Rows    []*Row
+}
+
+// Load reads a table from CSV. The header holds the input expressions, the
+// output columns prefixed with "out:" and optionally a "#priority" column.
+// Input cells are conditions such as `> 100`, `"DE","AT"`, `"DE"` or `-`
+func Load(r io.Reader, policy HitPolicy) (*Table, error) {
+	switch policy {
+	case Unique, First, Priority, Collect:
+	default:
+		return nil, fmt.Errorf("unknown hit policy: %q", policy)
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("missing header row")
+	}
+
+	t := &Table{Policy: policy}
+
+	header := records[0]
+	priorityCol := -1
+	inputCols, outputCols := make([]int, 0), make([]int, 0)
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		switch {
+		case h == PriorityColumn:
+			priorityCol = i
+		case strings.HasPrefix(h, OutputPrefix):
+			outputCols = append(outputCols, i)
+			t.Outputs = append(t.Outputs, strings.TrimSpace(strings.TrimPrefix(h, OutputPrefix)))
+		default:
+			if h == "" {
+				return nil, fmt.Errorf("column %d: empty input expression", i+1)
+			}
+			inputCols = append(inputCols, i)
+			t.Inputs = append(t.Inputs, h)
+		}
+	}
+
+	if len(inputCols) == 0 {
+		return nil, errors.New("no input columns")
+	}
+
+	if policy == Priority && priorityCol < 0 {
+		return nil, fmt.Errorf("hit policy %s requires a %q column", policy, PriorityColumn)
+	}
+
+	errs := make([]string, 0)
+	for n, record := range records[1:] {
+		row := &Row{Index: n + 1, Outputs: make(map[string]string)}
+
+		valid := true
+		for i, col := range inputCols {
+			cell := strings.TrimSpace(record[col])
+			cond, c, err := compileCell(t.Inputs[i], cell)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("row %d, column %q: %s", row.Index, t.Inputs[i], err))
+				valid = false
+				continue
+			}
+
+			row.cells = append(row.cells, c)
+			if cond != "" {
+				row.Conditions = append(row.Conditions, cond)
+			}
+		}
+
+		for i, col := range outputCols {
+			row.Outputs[t.Outputs[i]] = unquote(strings.TrimSpace(record[col]))
+		}
+
+		if priorityCol >= 0 {
+			p, err := strconv.Atoi(strings.TrimSpace(record[priorityCol]))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("row %d: invalid priority %q", row.Index, record[priorityCol]))
+			}
+			row.Priority = p
+		}
+
+		t.Rows = append(t.Rows, row)
+		if !valid {
+			continue
+		}
+
+		expr := "true"
+		if len(row.Conditions) > 0 {
+			expr = strings.Join(row.Conditions, " AND ")
+		}
+
+		row.rule, err = evaluator.NewRule(expr, map[string]interface{}{"row": row.Index})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("row %d: %s", row.Index, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+
+	return t, nil
+}
+
+// Evaluate RETURNS the rows selected by the hit policy for params. No
+// error is returned when no row matches
+func (t *Table) Evaluate(params map[string]interface{}) ([]*Row, error) {
+	matched := make([]*Row, 0)
+	for _, row := range t.Rows {
+		if row.rule.Eval(params) {
+			matched = append(matched, row)
+		}
+	}
+
+	if len(matched) == 0 {
+		return matched, nil
+	}
+
+	switch t.Policy {
+	case Unique:
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("%w: rows %s", ErrNotUnique, rowList(matched))
+		}
+		return matched, nil
+
+	case First:
+		return matched[:1], nil
+
+	case Priority:
+		best := matched[0]
+		for _, row := range matched[1:] {
+			if row.Priority > best.Priority {
+				best = row
+			}
+		}
+		return []*Row{best}, nil
+
+	default:
+		return matched, nil
+	}
+}
+
+// compileCell turns the cell into a condition on the input expression and
+// checks it parses. It RETURNS an empty condition for cells matching anything
+func compileCell(input, cell string) (string, constraint, error) {
+	if cell == "" || cell == AnyValue {
+		return "", constraint{kind: anyKind}, nil
+	}
+
+	subject := "(" + input + ")"
+
+	var cond string
+	switch values := splitValues(cell); {
+	case len(values) > 1:
+		cond = subject + " IN list(" + strings.Join(values, ", ") + ")"
+	case hasOperator(cell):
+		cond = subject + " " + cell
+	default:
+		cond = subject + " == " + cell
+	}
+
+	r, err := evaluator.NewRule(cond, map[string]interface{}{})
+	if err != nil {
+		return "", constraint{}, err
+	}
+
+	// the cell would change the meaning of the other conditions of the row
+	if stmt, ok := r.AST().Statement.(*parser.ExpressionStatement); ok {
+		if in, ok := stmt.Expression.(*parser.InfixExpression); ok {
+			if op := strings.ToLower(in.Operator); op == "and" || op == "or" {
+				return "", constraint{}, fmt.Errorf("%q is not a single condition", cell)
+			}
+		}
+	}
+
+	return "(" + cond + ")", analyze(cell), nil
+}
+
+var comparisons = []string{">=", "<=", "!=", "==", ">", "<"}
+
+func hasOperator(cell string) bool {
+	for _, op := range comparisons {
+		if strings.HasPrefix(cell, op) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitValues splits a comma separated cell, ignoring commas inside quotes
+func splitValues(cell string) []string {
+	values := make([]string, 0)
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(cell); i++ {
+		switch {
+		case cell[i] == '"' && (i == 0 || cell[i-1] != '\\'):
+			quoted = !quoted
+		case cell[i] == ',' && !quoted:
+			values = append(values, strings.TrimSpace(cell[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(values, strings.TrimSpace(cell[start:]))
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+func rowList(rows []*Row) string {
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, strconv.Itoa(r.Index))
+	}
+
+	return strings.Join(ids, ", ")
+}
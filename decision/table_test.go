@@ -0,0 +1,129 @@
+package decision
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const discounts = `amount,country,#priority,out:discount
+> 100,"""DE"",""AT""",1,0.1
+> 1000,-,2,0.2
+<= 100,"""DE""",1,0
+-,"""FR""",0,0.05
+`
+
+func load(t *testing.T, source string, policy HitPolicy) *Table {
+	table, err := Load(strings.NewReader(source), policy)
+	if err != nil {
+		t.Fatalf("could not load table: %s", err)
+	}
+
+	return table
+}
+
+func outputs(rows []*Row) []string {
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.Outputs["discount"])
+	}
+
+	return out
+}
+
+func TestHitPolicies(t *testing.T) {
+	testcases := []struct {
+		policy   HitPolicy
+		input    map[string]interface{}
+		expected []string
+		err      error
+	}{
+		{Unique, map[string]interface{}{"amount": 50, "country": "DE"}, []string{"0"}, nil},
+		{Unique, map[string]interface{}{"amount": 5000, "country": "AT"}, nil, ErrNotUnique},
+		{Unique, map[string]interface{}{"amount": 50, "country": "IT"}, []string{}, nil},
+		{First, map[string]interface{}{"amount": 5000, "country": "AT"}, []string{"0.1"}, nil},
+		{Priority, map[string]interface{}{"amount": 5000, "country": "AT"}, []string{"0.2"}, nil},
+		{Collect, map[string]interface{}{"amount": 5000, "country": "FR"}, []string{"0.2", "0.05"}, nil},
+	}
+
+	for i, tt := range testcases {
+		rows, err := load(t, discounts, tt.policy).Evaluate(tt.input)
+		if tt.err != nil {
+			assert.True(t, errors.Is(err, tt.err), fmt.Sprintf("tests[%d] - unexpected error %v", i, err))
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, outputs(rows), fmt.Sprintf("tests[%d] - outputs not equal", i))
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	testcases := []struct {
+		source string
+		policy HitPolicy
+		err    string
+	}{
+		{"a,out:x\n> 1,y\n", "ANY", `unknown hit policy: "ANY"`},
+		{"a,out:x\n> 1,y\n", Priority, `hit policy PRIORITY requires a "#priority" column`},
+		{"a,out:x\n> ,y\n>= 2,y\n== (,z\n", First, "row 1, column \"a\": no prefix parse function for EOF found\nrow 3, column \"a\": no prefix parse function for EOF found\nexpected next token to be ), got EOF instead"},
+		{"out:x\ny\n", First, "no input columns"},
+		{"a,b,out:x\n> 5 OR b == 1,2,y\n", First, `row 1, column "a": "> 5 OR b == 1" is not a single condition`},
+	}
+
+	for i, tt := range testcases {
+		_, err := Load(strings.NewReader(tt.source), tt.policy)
+		if assert.Error(t, err, fmt.Sprintf("tests[%d]", i)) {
+			assert.Equal(t, tt.err, err.Error(), fmt.Sprintf("tests[%d] - error not equal", i))
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	table := load(t, `amount,country,out:x
+> 100,"""DE"",""AT""",a
+> 1000,-,b
+<= 100,"""DE""",c
+<= 100,"!= ""DE""",d
+`, Unique)
+
+	issues := table.Validate()
+
+	messages := make([]string, 0, len(issues))
+	for _, i := range issues {
+		messages = append(messages, i.String())
+	}
+
+	assert.Equal(t, []string{
+		"overlap: rows 1 and 2 can match the same input",
+		`gap: no row matches amount = 550, country = <other>`,
+		`gap: no row matches amount = 1000, country = <other>`,
+	}, messages)
+
+	// strings holding numbers overlap with the numbers
+	table = load(t, `code,out:x
+"""1"",""2""",a
+1,b
+`, Unique)
+
+	issues = table.Validate()
+	if assert.NotEmpty(t, issues) {
+		assert.Equal(t, Issue{Kind: Overlap, Rows: []int{1, 2}, Message: "rows 1 and 2 can match the same input"}, issues[0])
+	}
+	assert.Equal(t, []string{`((code) IN list("1", "2"))`}, table.Rows[0].Conditions)
+
+	// cells that can't be analyzed are assumed to match anything
+	table = load(t, `amount,out:x
+> limit,a
+<= 100,b
+`, Unique)
+
+	issues = table.Validate()
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, Overlap, issues[0].Kind)
+		assert.Equal(t, []int{1, 2}, issues[0].Rows)
+	}
+}
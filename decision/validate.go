@@ -0,0 +1,382 @@
+package decision
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maximum number of input combinations checked when looking for gaps
+const maxCombinations = 10000
+
+type IssueKind string
+
+const (
+	Overlap IssueKind = "overlap"
+	Gap     IssueKind = "gap"
+)
+
+// Issue is a problem found by Validate
+type Issue struct {
+	Kind    IssueKind
+	Rows    []int
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Kind, i.Message)
+}
+
+type constraintKind int
+
+const (
+	anyKind      constraintKind = iota
+	setKind                     // == value, IN values
+	notSetKind                  // != value
+	intervalKind                // >, >=, <, <=
+	opaqueKind                  // anything that can't be analyzed
+)
+
+// constraint is the static view of a cell used for validation
+type constraint struct {
+	kind   constraintKind
+	values map[string]bool // value keys for set kinds
+
+	lo, hi         float64
+	loIncl, hiIncl bool
+}
+
+// Validate checks the table for rows that overlap, which is only an error
+// for the UNIQUE policy, and for input combinations no row covers. Cells
+// that can't be analyzed are assumed to match anything
+func (t *Table) Validate() []Issue {
+	issues := make([]Issue, 0)
+
+	if t.Policy == Unique {
+		for i := 0; i < len(t.Rows); i++ {
+			for j := i + 1; j < len(t.Rows); j++ {
+				if overlaps(t.Rows[i], t.Rows[j]) {
+					issues = append(issues, Issue{
+						Kind:    Overlap,
+						Rows:    []int{t.Rows[i].Index, t.Rows[j].Index},
+						Message: fmt.Sprintf("rows %d and %d can match the same input", t.Rows[i].Index, t.Rows[j].Index),
+					})
+				}
+			}
+		}
+	}
+
+	return append(issues, t.gaps()...)
+}
+
+func overlaps(a, b *Row) bool {
+	for i := range a.cells {
+		if !intersects(a.cells[i], b.cells[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func intersects(a, b constraint) bool {
+	if a.kind > b.kind {
+		a, b = b, a
+	}
+
+	switch {
+	case a.kind == anyKind:
+		return true
+
+	case a.kind == setKind && b.kind == setKind:
+		for k := range a.values {
+			if b.values[k] {
+				return true
+			}
+		}
+		return false
+
+	case a.kind == setKind && b.kind == notSetKind:
+		for k := range a.values {
+			if !b.values[k] {
+				return true
+			}
+		}
+		return false
+
+	case a.kind == setKind && b.kind == intervalKind:
+		for k := range a.values {
+			if n, ok := keyNumber(k); ok && b.contains(n) {
+				return true
+			}
+		}
+		return false
+
+	case a.kind == notSetKind && b.kind == intervalKind:
+		if b.lo == b.hi {
+			return !a.values[numberKey(b.lo)]
+		}
+		return true
+
+	case a.kind == intervalKind && b.kind == intervalKind:
+		lo, loIncl := a.lo, a.loIncl
+		if b.lo > lo || (b.lo == lo && !b.loIncl) {
+			lo, loIncl = b.lo, b.loIncl
+		}
+
+		hi, hiIncl := a.hi, a.hiIncl
+		if b.hi < hi || (b.hi == hi && !b.hiIncl) {
+			hi, hiIncl = b.hi, b.hiIncl
+		}
+
+		return lo < hi || (lo == hi && loIncl && hiIncl)
+
+	default:
+		return true
+	}
+}
+
+// point is a representative input value of a column
+type point struct {
+	key   string
+	label string
+}
+
+// gaps enumerates representative values of every column and reports the
+// combinations no row matches
+func (t *Table) gaps() []Issue {
+	points := make([][]point, len(t.Inputs))
+	combinations := 1
+	for col := range t.Inputs {
+		points[col] = t.columnPoints(col)
+		combinations *= len(points[col])
+		if combinations > maxCombinations {
+			return []Issue{}
+		}
+	}
+
+	issues := make([]Issue, 0)
+	current := make([]point, len(t.Inputs))
+
+	var walk func(col int)
+	walk = func(col int) {
+		if col == len(t.Inputs) {
+			if !t.covered(current) {
+				parts := make([]string, 0, len(current))
+				for i, p := range current {
+					parts = append(parts, fmt.Sprintf("%s = %s", t.Inputs[i], p.label))
+				}
+				issues = append(issues, Issue{Kind: Gap, Message: "no row matches " + strings.Join(parts, ", ")})
+			}
+			return
+		}
+
+		for _, p := range points[col] {
+			current[col] = p
+			walk(col + 1)
+		}
+	}
+	walk(0)
+
+	return issues
+}
+
+func (t *Table) covered(input []point) bool {
+	for _, row := range t.Rows {
+		match := true
+		for i, c := range row.cells {
+			if !c.matches(input[i].key) {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Table) columnPoints(col int) []point {
+	keys := make(map[string]bool)
+	bounds := make([]float64, 0)
+	analyzed, strs := false, false
+
+	for _, row := range t.Rows {
+		c := row.cells[col]
+		switch c.kind {
+		case setKind, notSetKind:
+			analyzed = true
+			for k := range c.values {
+				if n, ok := keyNumber(k); ok {
+					bounds = append(bounds, n)
+					continue
+				}
+				keys[k] = true
+				strs = true
+			}
+		case intervalKind:
+			analyzed = true
+			for _, b := range []float64{c.lo, c.hi} {
+				if !math.IsInf(b, 0) {
+					bounds = append(bounds, b)
+				}
+			}
+		}
+	}
+
+	if !analyzed {
+		return []point{{key: "", label: AnyValue}}
+	}
+
+	sort.Float64s(bounds)
+	if len(bounds) > 0 {
+		keys[numberKey(bounds[0]-1)] = true
+		keys[numberKey(bounds[len(bounds)-1]+1)] = true
+		for i, b := range bounds {
+			keys[numberKey(b)] = true
+			if i > 0 && bounds[i-1] != b {
+				keys[numberKey((bounds[i-1]+b)/2)] = true
+			}
+		}
+	}
+
+	points := make([]point, 0, len(keys)+1)
+	for k := range keys {
+		points = append(points, point{key: k, label: keyLabel(k)})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		a, aok := keyNumber(points[i].key)
+		b, bok := keyNumber(points[j].key)
+		if aok && bok {
+			return a < b
+		}
+		return points[i].key < points[j].key
+	})
+
+	// a string none of the cells mention, numbers are covered by the bounds
+	if strs {
+		points = append(points, point{key: "other", label: "<other>"})
+	}
+
+	return points
+}
+
+func (c constraint) matches(key string) bool {
+	switch c.kind {
+	case setKind:
+		return c.values[key]
+	case notSetKind:
+		return !c.values[key]
+	case intervalKind:
+		n, ok := keyNumber(key)
+		return ok && c.contains(n)
+	default:
+		return true
+	}
+}
+
+func (c constraint) contains(n float64) bool {
+	return (n > c.lo || (c.loIncl && n == c.lo)) && (n < c.hi || (c.hiIncl && n == c.hi))
+}
+
+// analyze builds the constraint of a cell that compiled successfully
+func analyze(cell string) constraint {
+	if cell == "" || cell == AnyValue {
+		return constraint{kind: anyKind}
+	}
+
+	if values := splitValues(cell); len(values) > 1 {
+		c := constraint{kind: setKind, values: make(map[string]bool)}
+		for _, v := range values {
+			k, ok := valueKey(v)
+			if !ok {
+				return constraint{kind: opaqueKind}
+			}
+			c.values[k] = true
+		}
+		return c
+	}
+
+	op := "=="
+	for _, o := range comparisons {
+		if strings.HasPrefix(cell, o) {
+			op = o
+			cell = strings.TrimSpace(strings.TrimPrefix(cell, o))
+			break
+		}
+	}
+
+	k, ok := valueKey(cell)
+	if !ok {
+		return constraint{kind: opaqueKind}
+	}
+
+	switch op {
+	case "==":
+		return constraint{kind: setKind, values: map[string]bool{k: true}}
+	case "!=":
+		return constraint{kind: notSetKind, values: map[string]bool{k: true}}
+	}
+
+	n, ok := keyNumber(k)
+	if !ok {
+		return constraint{kind: opaqueKind}
+	}
+
+	c := constraint{kind: intervalKind, lo: math.Inf(-1), hi: math.Inf(1)}
+	switch op {
+	case ">":
+		c.lo = n
+	case ">=":
+		c.lo, c.loIncl = n, true
+	case "<":
+		c.hi = n
+	case "<=":
+		c.hi, c.hiIncl = n, true
+	}
+
+	return c
+}
+
+// valueKey RETURNS the key of a literal cell value. Strings holding a number
+// share the key of the number, IN compares them as text
+func valueKey(v string) (string, bool) {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		if n, err := strconv.ParseFloat(v[1:len(v)-1], 64); err == nil {
+			return numberKey(n), true
+		}
+		return "s:" + v[1:len(v)-1], true
+	}
+
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return numberKey(n), true
+	}
+
+	return "", false
+}
+
+func numberKey(n float64) string {
+	return "n:" + strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func keyNumber(k string) (float64, bool) {
+	if !strings.HasPrefix(k, "n:") {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(k[2:], 64)
+	return n, err == nil
+}
+
+func keyLabel(k string) string {
+	if strings.HasPrefix(k, "s:") {
+		return strconv.Quote(k[2:])
+	}
+
+	return strings.TrimPrefix(k, "n:")
+}
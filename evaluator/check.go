@@ -0,0 +1,160 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// Diagnostic is a problem found by Check
+type Diagnostic struct {
+	Node    string // the offending expression, empty for parse errors
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Node == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Node, d.Message)
+}
+
+// result types of the builtins, the other functions are not typed
+var nativeFnTypes = map[string]ObjectType{
+	strings.ToLower(ListFN):       RegexListObject,
+	strings.ToLower(MatchesFN):    BooleanObject,
+	strings.ToLower(ExtractFN):    StringObject,
+	strings.ToLower(ExtractAllFN): StringListObject,
+	strings.ToLower(ReplaceReFN):  StringObject,
+}
+
+// Check parses the expression with the limits of the engine and RETURNS
+// the problems found without evaluating it: parse errors, undefined
+// functions, operators applied to operands of the wrong types and rules
+// not evaluating to a boolean. Identifiers and lists are typed at
+// evaluation, the operators applied to them are not checked
+func (en *Engine) Check(expression string) []Diagnostic {
+	en.mtx.Lock()
+	limits := en.limits
+	en.mtx.Unlock()
+
+	rule, err := limits.parse(expression, nil)
+	if err != nil {
+		diagnostics := make([]Diagnostic, 0)
+		for _, msg := range strings.Split(err.Error(), "\n") {
+			diagnostics = append(diagnostics, Diagnostic{Message: msg})
+		}
+		return diagnostics
+	}
+
+	c := &checker{functions: en.loadFunctions(), diagnostics: make([]Diagnostic, 0)}
+	stmt, _ := rule.Statement.(*parser.ExpressionStatement)
+	if stmt == nil || stmt.Expression == nil {
+		return []Diagnostic{{Message: "empty expression"}}
+	}
+
+	if t := c.check(stmt.Expression); t != "" && t != BooleanObject {
+		c.report(stmt.Expression, "rule evaluates to %s, not Boolean", t)
+	}
+
+	return c.diagnostics
+}
+
+type checker struct {
+	functions   map[string]ContextFunction
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(node parser.Node, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{Node: parser.Format(node), Message: fmt.Sprintf(format, a...)})
+}
+
+// check RETURNS the type node evaluates to, empty when it is only known at
+// evaluation or when node is invalid
+func (c *checker) check(node parser.Expression) ObjectType {
+	switch node := node.(type) {
+	case *parser.NumberLiteral:
+		return NumberObject
+	case *parser.StringLiteral:
+		return StringObject
+	case *parser.BooleanLiteral:
+		return BooleanObject
+	case *parser.Regex:
+		return RegexObject
+
+	case *parser.PrefixExpression:
+		right := c.check(node.Right)
+		if right != "" && right != NumberObject {
+			c.report(node, "operator %s not defined on %s", node.Operator, right)
+			return ""
+		}
+		return NumberObject
+
+	case *parser.InfixExpression:
+		left, right := placeholder(c.check(node.Left)), placeholder(c.check(node.Right))
+		if left == nil || right == nil {
+			return operatorType(node.Operator)
+		}
+
+		// the operands are typed, the operator is applied to placeholders
+		// of their types
+		result := evalInfixExpression(node.Operator, left, right)
+		if isError(result) {
+			c.report(node, "operator %s not defined on %s and %s", strings.ToLower(node.Operator), left.Type(), right.Type())
+			return ""
+		}
+		return result.Type()
+
+	case *parser.CallExpression:
+		for _, a := range node.Arguments {
+			c.check(a)
+		}
+
+		name := strings.ToLower(node.Function.String())
+		if _, ok := c.functions[name]; !ok {
+			c.report(node, "undefined function: %s", node.Function.String())
+			return ""
+		}
+		// a builtin replaced through Register is assumed to keep its type
+		return nativeFnTypes[name]
+
+	default:
+		// identifiers and lists
+		return ""
+	}
+}
+
+// operatorType RETURNS the type of the result of operator whatever its
+// operands
+func operatorType(operator string) ObjectType {
+	switch strings.ToLower(operator) {
+	case "+", "-", "*", "/":
+		return NumberObject
+	default:
+		return BooleanObject
+	}
+}
+
+func placeholder(t ObjectType) Object {
+	switch t {
+	case NumberObject:
+		// not zero so divisions are defined
+		return &Number{Value: 1}
+	case StringObject:
+		return &String{}
+	case BooleanObject:
+		return &Boolean{}
+	case RegexObject:
+		return &Regex{}
+	case RegexListObject:
+		return NewRegexList(nil)
+	case StringListObject:
+		return NewStringList(nil)
+	case NumberListObject:
+		return NewNumberList(nil)
+	default:
+		// typed at evaluation
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		expression  string
+		diagnostics []string
+	}{
+		{`a == 1 and b contains "x"`, []string{}},
+		{`matches(name, r"^a") and extract(name, r"(a)", 1) == "a"`, []string{}},
+		{`-a > 1 and a / 2 < 3`, []string{}},
+		{`"x" in list("x", "y")`, []string{}},
+		{`"a" > 1`, []string{`"a" > 1: operator > not defined on String and Number`}},
+		{`1 and a`, []string{}},
+		{`1 and true`, []string{`1 and true: operator and not defined on Number and Boolean`}},
+		{`-"a" == 1`, []string{`-"a": operator - not defined on String`}},
+		{`upper(a) == "A"`, []string{`upper(a): undefined function: upper`}},
+		{`a + 1`, []string{`a + 1: rule evaluates to Number, not Boolean`}},
+		{`a ==`, []string{`no prefix parse function for EOF found`}},
+		{``, []string{`empty expression`}},
+	}
+
+	en := NewEngine()
+	for i, tt := range tests {
+		diagnostics := make([]string, 0)
+		for _, d := range en.Check(tt.expression) {
+			diagnostics = append(diagnostics, d.String())
+		}
+
+		assert.Equal(t, tt.diagnostics, diagnostics, fmt.Sprintf("tests[%d]", i))
+	}
+}
@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowListProvider blocks until the list is released or ctx is done
+type slowListProvider struct {
+	release chan struct{}
+}
+
+func (p *slowListProvider) List(name string) ([]string, error) {
+	<-p.release
+	return []string{"a"}, nil
+}
+
+func (p *slowListProvider) ListContext(ctx context.Context, name string) ([]string, error) {
+	select {
+	case <-p.release:
+		return []string{"a"}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	r, err := NewRule(`a == 1 and b == 2`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	params := map[string]interface{}{"a": 1, "b": 2}
+
+	res, err := r.EvalContext(context.Background(), params)
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = r.EvalContext(ctx, params)
+	assert.False(t, res)
+	assert.True(t, errors.Is(err, context.Canceled))
+	var re *RuleError
+	if assert.True(t, errors.As(err, &re)) {
+		assert.Equal(t, CodeCancelled, re.Code)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = r.EvalContext(ctx, params)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	if assert.True(t, errors.As(err, &re)) {
+		assert.Equal(t, CodeTimeout, re.Code)
+	}
+}
+
+func TestEvalContextSlowListProvider(t *testing.T) {
+	r, err := NewRule(`s contains @SLOW`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p := &slowListProvider{release: make(chan struct{})}
+	defer close(p.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = r.EvalWithListsContext(ctx, map[string]interface{}{"s": "a"}, NewCachingListProvider(WithListKinds(p, nil), time.Minute))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	var re *RuleError
+	if assert.True(t, errors.As(err, &re), "%v", err) {
+		assert.Equal(t, CodeTimeout, re.Code)
+	}
+}
+
+func TestEvalWithListsContextErrors(t *testing.T) {
+	r, err := NewRule(`missing > 1 OR s contains @L`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	lists := NewMemoryListProvider(map[string][]string{"L": {"a"}})
+	res, err := r.EvalWithListsContext(context.Background(), map[string]interface{}{"s": "a"}, lists)
+	assert.False(t, res)
+	var re *RuleError
+	if assert.True(t, errors.As(err, &re), "%v", err) {
+		assert.Equal(t, CodeEval, re.Code)
+	}
+	assert.EqualError(t, err, "eval: identifier not found: missing")
+}
+
+func TestRuleSetEvalFailures(t *testing.T) {
+	a, _ := NewRule(`a == 1`, nil)
+	b, _ := NewRule(`b == 2`, nil)
+	c, _ := NewRule(`c == 3`, nil)
+	rs := NewRuleSet(a, b, c)
+
+	matched, failures, err := rs.EvalFailures(context.Background(), map[string]interface{}{"a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Rule{a}, matched)
+	if assert.Len(t, failures, 2) {
+		assert.Equal(t, b, failures[0].Rule)
+		assert.Equal(t, c, failures[1].Rule)
+		var re *RuleError
+		assert.True(t, errors.As(failures[0], &re))
+	}
+
+	// EvalContext reports the first failure
+	matched, err = rs.EvalContext(context.Background(), map[string]interface{}{"a": 1})
+	assert.Equal(t, []*Rule{a}, matched)
+	assert.EqualError(t, err, `rule "b == 2": eval: identifier not found: b`)
+}
@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// Engine compiles rules sharing a set of functions and options. Functions
+// can be registered while the rules of the engine are evaluated, the rules
+// see the functions registered before each evaluation starts
+type Engine struct {
+	mtx *sync.Mutex // serializes the writers
+
+	// map[string]ContextFunction replaced as a whole on every registration
+	functions atomic.Value
+
+	limits Limits
+	trace  io.Writer
+}
+
+var defaultEngine = NewEngine()
+
+// NewEngine RETURNS an engine with the builtin functions and DefaultLimits
+func NewEngine() *Engine {
+	en := &Engine{mtx: &sync.Mutex{}, limits: DefaultLimits}
+
+	functions := make(map[string]ContextFunction, len(nativeFns))
+	for name, fn := range nativeFns {
+		functions[name] = fn
+	}
+	en.functions.Store(functions)
+
+	return en
+}
+
+// Register makes fn callable from the rules of the engine as name, names
+// are case insensitive. A function registered with the name of a builtin
+// replaces it
+func (en *Engine) Register(name string, fn Function) error {
+	if fn == nil {
+		return errors.New("register: name and function are required")
+	}
+
+	return en.RegisterContext(name, fn.withContext())
+}
+
+// RegisterContext is Register for a function receiving the context of the
+// evaluation, context.Background() when the rule is evaluated without one
+func (en *Engine) RegisterContext(name string, fn ContextFunction) error {
+	if name == "" || fn == nil {
+		return errors.New("register: name and function are required")
+	}
+	if !isIdentifier(name) {
+		return fmt.Errorf("register: invalid function name %q", name)
+	}
+
+	en.mtx.Lock()
+	defer en.mtx.Unlock()
+
+	current := en.loadFunctions()
+	functions := make(map[string]ContextFunction, len(current)+1)
+	for n, f := range current {
+		functions[n] = f
+	}
+	functions[strings.ToLower(name)] = fn
+	en.functions.Store(functions)
+
+	return nil
+}
+
+// SetLimits sets the limits of the rules compiled afterwards
+func (en *Engine) SetLimits(limits Limits) {
+	en.mtx.Lock()
+	defer en.mtx.Unlock()
+
+	en.limits = limits
+}
+
+// SetTrace writes the parser trace of the rules compiled afterwards to w,
+// a nil writer disables tracing
+func (en *Engine) SetTrace(w io.Writer) {
+	en.mtx.Lock()
+	defer en.mtx.Unlock()
+
+	en.trace = w
+}
+
+// NewRule compiles the expression with the limits of the engine
+func (en *Engine) NewRule(expression string, metadata map[string]interface{}) (*Rule, error) {
+	en.mtx.Lock()
+	limits, trace := en.limits, en.trace
+	en.mtx.Unlock()
+
+	return en.compile(expression, metadata, limits, trace)
+}
+
+// Eval evaluates node with the functions of the engine
+func (en *Engine) Eval(node parser.Node, env *Environment) Object {
+	e := &evaluation{functions: en.loadFunctions()}
+	return e.eval(node, env)
+}
+
+func (en *Engine) compile(expression string, metadata map[string]interface{}, limits Limits, trace io.Writer) (*Rule, error) {
+	parsedRule, err := limits.parse(expression, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rule{
+		expression: expression,
+		parsedRule: parsedRule,
+		metadata:   copyMetadata(metadata),
+		lists:      referencedLists(parsedRule),
+		limits:     limits,
+		engine:     en,
+	}, nil
+}
+
+func (en *Engine) loadFunctions() map[string]ContextFunction {
+	return en.functions.Load().(map[string]ContextFunction)
+}
+
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+
+	return c
+}
+
+// isIdentifier reports whether name lexes as a single identifier: letters,
+// digits and underscores not starting with a digit, keywords excluded
+func isIdentifier(name string) bool {
+	for i, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || i > 0 && '0' <= ch && ch <= '9') {
+			return false
+		}
+	}
+
+	return parser.LookupIdent(name) == parser.IDENT
+}
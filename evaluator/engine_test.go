@@ -0,0 +1,192 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineFunctions(t *testing.T) {
+	en := NewEngine()
+	upper := func(args []Object) (Object, error) {
+		if len(args) != 1 || args[0].Type() != StringObject {
+			return nil, errors.New("expected a string")
+		}
+		return &String{Value: strings.ToUpper(args[0].(*String).Value)}, nil
+	}
+
+	r, err := en.NewRule(`upper(country) == "DE"`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	params := map[string]interface{}{"country": "de"}
+	_, err = r.Evaluate(params)
+	assert.EqualError(t, err, "eval: undefined function: upper")
+
+	// functions registered later are seen by the rules already compiled
+	assert.NoError(t, en.Register("UPPER", upper))
+	res, err := r.Evaluate(params)
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	// other engines and the package level rules are unaffected
+	other, _ := NewEngine().NewRule(`upper(country) == "DE"`, nil)
+	assert.False(t, other.Eval(params))
+	global, _ := NewRule(`upper(country) == "DE"`, nil)
+	assert.False(t, global.Eval(params))
+
+	assert.Error(t, en.Register("", upper))
+	assert.Error(t, en.Register("up-per", upper))
+	assert.Error(t, en.Register("lower", nil))
+
+	// names lex like identifiers, keywords are not identifiers
+	for i, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"sha256", true},
+		{"log_2", true},
+		{"2x", false},
+		{"in", false},
+		{"CONTAINS", false},
+		{"true", false},
+	} {
+		assert.Equal(t, tt.valid, en.Register(tt.name, upper) == nil, fmt.Sprintf("tests[%d]", i))
+	}
+
+	sha, err := en.NewRule(`sha256(country) == "DE"`, nil)
+	if assert.NoError(t, err) {
+		assert.True(t, sha.Eval(params))
+	}
+}
+
+func TestRegisterContext(t *testing.T) {
+	type tenantKey struct{}
+
+	en := NewEngine()
+	tenant := func(ctx context.Context, args []Object) (Object, error) {
+		name, _ := ctx.Value(tenantKey{}).(string)
+		return &String{Value: name}, nil
+	}
+	assert.NoError(t, en.RegisterContext("tenant", tenant))
+	assert.Error(t, en.RegisterContext("tenant", nil))
+
+	r, err := en.NewRule(`tenant() == "acme"`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	res, err := r.EvalContext(context.WithValue(context.Background(), tenantKey{}, "acme"), nil)
+	assert.NoError(t, err)
+	assert.True(t, res)
+
+	// evaluated without a context the function gets context.Background()
+	assert.False(t, r.Eval(nil))
+
+	// the call being evaluated is available to the function
+	var called string
+	assert.NoError(t, en.RegisterContext("called", func(ctx context.Context, args []Object) (Object, error) {
+		call, _ := CallFrom(ctx)
+		called = call.String()
+		return &Boolean{Value: true}, nil
+	}))
+	r, _ = en.NewRule(`called(a, 1)`, nil)
+	assert.True(t, r.Eval(map[string]interface{}{"a": 1}))
+	assert.Equal(t, "called(a, 1)", called)
+}
+
+func TestEngineOptions(t *testing.T) {
+	en := NewEngine()
+	en.SetLimits(Limits{MaxNodes: 3})
+
+	_, err := en.NewRule(`a == 1 and b == 2`, nil)
+	var re *RuleError
+	if assert.True(t, errors.As(err, &re)) {
+		assert.Equal(t, CodeNodes, re.Code)
+	}
+
+	var trace bytes.Buffer
+	en.SetTrace(&trace)
+	_, err = en.NewRule(`a == 1`, nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(trace.String(), "BEGIN parseExpressionStatement\n"))
+}
+
+func TestWithMetadata(t *testing.T) {
+	md := map[string]interface{}{"id": "r1"}
+	r, _ := NewRule(`a == 1`, md)
+
+	// the rule keeps its own copy of the metadata
+	md["id"] = "changed"
+	assert.Equal(t, "r1", r.GetMetadata("id"))
+
+	c := r.WithMetadata("owner", "fraud")
+	assert.Equal(t, "fraud", c.GetMetadata("owner"))
+	assert.Equal(t, "r1", c.GetMetadata("id"))
+	assert.Nil(t, r.GetMetadata("owner"))
+	assert.Equal(t, r.Expression(), c.Expression())
+}
+
+func TestConcurrentEval(t *testing.T) {
+	en := NewEngine()
+	rules := make([]*Rule, 0)
+	for _, expr := range []string{
+		`email contains @BLOCKLIST and amount >= 100`,
+		`extract(url, r"utm_source=(\w+)", 1) == "newsletter"`,
+		`country in list("DE", "AT") or twice(amount) > 500`,
+	} {
+		r, err := en.NewRule(expr, map[string]interface{}{"reason": "${match.entry}"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		rules = append(rules, r)
+	}
+
+	twice := func(args []Object) (Object, error) {
+		if len(args) != 1 || args[0].Type() != NumberObject {
+			return nil, errors.New("expected a number")
+		}
+		return &Number{Value: 2 * args[0].(*Number).Value}, nil
+	}
+
+	rs := NewRuleSet(rules...)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				params := map[string]interface{}{
+					"email":     fmt.Sprintf("user%d@spam.com", i),
+					"amount":    float64(i),
+					"url":       "https://x.com/?utm_source=newsletter",
+					"country":   "FR",
+					"BLOCKLIST": []string{`@spam\.com$`, `^admin@`},
+				}
+
+				// functions are registered while the rules are evaluated
+				if g == 0 && i == 100 {
+					assert.NoError(t, en.Register("twice", twice))
+				}
+
+				assert.True(t, rules[0].Eval(params) == (i >= 100))
+				assert.True(t, rules[1].Eval(params))
+				rules[2].Eval(params)
+				rules[0].EvalResult(params)
+				rules[1].Explain(params)
+				rs.Eval(params)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.True(t, rules[2].Eval(map[string]interface{}{"country": "FR", "amount": 300}))
+}
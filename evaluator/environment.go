@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 )
 
@@ -14,6 +16,7 @@ func NewEnvironment(bindings map[string]interface{}) *Environment {
 
 type Environment struct {
 	store map[string]Object
+	lists ListProvider
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -21,6 +24,88 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// SetListProvider sets the provider of the lists missing from the bindings
+func (e *Environment) SetListProvider(lists ListProvider) {
+	e.lists = lists
+}
+
+// GetList RETURNS the list bound to name, fetching it from the list
+// provider when it isn't bound yet
+func (e *Environment) GetList(name string) (Object, error) {
+	return e.GetListContext(context.Background(), name)
+}
+
+// GetListContext is GetList giving up when ctx is done
+func (e *Environment) GetListContext(ctx context.Context, name string) (Object, error) {
+	if obj, ok := e.store[name]; ok {
+		return obj, nil
+	}
+
+	if e.lists == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrListNotFound)
+	}
+
+	kind := RegexKind
+	if kinds, ok := e.lists.(ListKinds); ok {
+		if k := kinds.ListKind(name); k != "" {
+			kind = k
+		}
+	}
+
+	// the caching provider keeps the lists it built
+	if p, ok := e.lists.(listBuilder); ok {
+		list, err := p.buildList(ctx, name, kind)
+		if err != nil {
+			return nil, err
+		}
+		return e.Set(name, list), nil
+	}
+
+	values, err := fetchList(ctx, e.lists, name)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := buildList(name, kind, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Set(name, list), nil
+}
+
+// listBuilder is implemented by the list providers building the list
+// objects themselves
+type listBuilder interface {
+	buildList(ctx context.Context, name string, kind ListKind) (Object, error)
+}
+
+func buildList(name string, kind ListKind, values []string) (Object, error) {
+	list, err := NewList(kind, values)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", name, err)
+	}
+
+	return list, nil
+}
+
+// Prefetch fetches the named lists from the list provider so that a failing
+// provider is reported before the evaluation starts
+func (e *Environment) Prefetch(names []string) error {
+	return e.PrefetchContext(context.Background(), names)
+}
+
+// PrefetchContext is Prefetch giving up when ctx is done
+func (e *Environment) PrefetchContext(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if _, err := e.GetListContext(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
@@ -29,15 +114,29 @@ func (e *Environment) Set(name string, val Object) Object {
 func buildEnv(env *Environment, bindings map[string]interface{}) {
 	for k, v := range bindings {
 
+		// lists of a specific kind are bound as they are
+		if obj, ok := v.(Object); ok {
+			env.Set(k, obj)
+			continue
+		}
+
 		valPtr := reflect.ValueOf(v)
 		switch valPtr.Kind() {
 		case reflect.Slice:
-			val, ok := v.([]string)
-			if !ok {
+			switch val := v.(type) {
+			case []string:
+				env.Set(k, NewRegexList(val))
+			case []float64:
+				env.Set(k, NewNumberList(val))
+			case []int:
+				numbers := make([]float64, 0, len(val))
+				for _, n := range val {
+					numbers = append(numbers, float64(n))
+				}
+				env.Set(k, NewNumberList(numbers))
+			default:
 				env.Set(k, &Error{Message: "Invalid value"})
-				continue
 			}
-			env.Set(k, NewRegexList(val))
 
 		case reflect.String:
 			env.Set(k, &String{Value: v.(string)})
@@ -1,27 +1,87 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	parser "github.com/zain-bahsarat/rule_egine/parser"
 )
 
-// bind native funcitons
-func init() {
-	bindNativeFns(ListFN, list)
+func Eval(node parser.Node, env *Environment) Object {
+	e := &evaluation{}
+	return e.eval(node, env)
 }
 
-func Eval(node parser.Node, env *Environment) Object {
+// evaluation holds the state of a single evaluation
+type evaluation struct {
+	// trace of the node being evaluated, nil when not explaining
+	trace *Trace
+
+	// list entries that made list operators true, when recordMatches is set
+	recordMatches bool
+	matches       []ListMatch
+
+	limits Limits
+	steps  int
+	// cancellation of the evaluation, nil when it can't be cancelled
+	ctx context.Context
+	// limit or cancellation error stopping the evaluation
+	err *Error
+
+	// functions callable from the rule, the builtins when nil
+	functions map[string]ContextFunction
+}
+
+func (e *evaluation) function(name string) (ContextFunction, bool) {
+	functions := e.functions
+	if functions == nil {
+		functions = nativeFns
+	}
+
+	fn, ok := functions[strings.ToLower(name)]
+	return fn, ok
+}
+
+func (e *evaluation) eval(node parser.Node, env *Environment) Object {
+	if err := e.interrupted(); err != nil {
+		return err
+	}
+	if err := e.step(); err != nil {
+		return err
+	}
+
+	switch node.(type) {
+	case *parser.Rule, *parser.ExpressionStatement:
+		return e.visit(node, env)
+	}
+
+	if e.trace == nil {
+		return e.visit(node, env)
+	}
+
+	parent := e.trace
+	e.trace = &Trace{Node: node.String()}
+	parent.Children = append(parent.Children, e.trace)
+
+	obj := e.visit(node, env)
+	e.trace.Value = obj
+	e.trace = parent
+
+	return obj
+}
+
+func (e *evaluation) visit(node parser.Node, env *Environment) Object {
 
 	switch node := node.(type) {
 
 	case *parser.Rule:
-		return Eval(node.Statement, env)
+		return e.eval(node.Statement, env)
 
 	case *parser.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.eval(node.Expression, env)
 
 	case *parser.NumberLiteral:
 		return &Number{Value: node.Value}
@@ -43,34 +103,87 @@ func Eval(node parser.Node, env *Environment) Object {
 		return &Regex{Value: node.Value}
 
 	case *parser.ListName:
-		val, ok := env.Get(node.Value)
-		if !ok {
-			return newError("missing list: " + node.Value)
+		if err := e.interrupted(); err != nil {
+			return err
+		}
+
+		val, err := env.GetListContext(e.context(), node.Value)
+		if err != nil {
+			if err := e.interrupted(); err != nil {
+				return err
+			}
+			return newError("missing list: %s", err)
 		}
 
 		return val
 
 	case *parser.CallExpression:
-		fn, ok := nativeFns[node.Function.String()]
+		fn, ok := e.function(node.Function.String())
 		if !ok {
 			return newError("undefined function: " + node.Function.String())
 		}
 
-		val, err := fn(node.Arguments)
+		args := make([]Object, 0, len(node.Arguments))
+		for _, a := range node.Arguments {
+			arg := e.eval(a, env)
+			if arg == nil {
+				return newError("invalid argument: %s", a.String())
+			}
+			if arg.Type() == ErrorObject {
+				return arg
+			}
+			args = append(args, arg)
+		}
+
+		if regexFns[strings.ToLower(node.Function.String())] && len(args) > 0 {
+			if err := e.checkRegexInput(args[0]); err != nil {
+				return err
+			}
+		}
+
+		if err := e.interrupted(); err != nil {
+			return err
+		}
+
+		val, err := fn(context.WithValue(e.context(), callKey{}, node), args)
 		if err != nil {
-			return newError(err.Error())
+			return newError("%s: %s", node.Function.String(), err)
 		}
 
-		return toObject(val)
+		return val
 
 	case *parser.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *parser.InfixExpression:
-		left := Eval(node.Left, env)
-		right := Eval(node.Right, env)
-		return evalInfixExpression(node.Operator, left, right)
+		left := e.eval(node.Left, env)
+		right := e.eval(node.Right, env)
+		for _, operand := range []Object{left, right} {
+			if isError(operand) {
+				return operand
+			}
+		}
+
+		if isPattern(right) {
+			if err := e.checkRegexInput(left); err != nil {
+				return err
+			}
+		} else if isPattern(left) {
+			if err := e.checkRegexInput(right); err != nil {
+				return err
+			}
+		}
+
+		result := evalInfixExpression(node.Operator, left, right)
+		if e.recordMatches {
+			e.recordMatch(node, left, right, result)
+		}
+
+		return result
 
 	default:
 		return newError("unknown: %q", node.String())
@@ -78,6 +191,19 @@ func Eval(node parser.Node, env *Environment) Object {
 
 }
 
+func isError(obj Object) bool {
+	return obj == nil || obj.Type() == ErrorObject
+}
+
+func isPattern(obj Object) bool {
+	switch obj.(type) {
+	case *Regex, *RegexList:
+		return true
+	default:
+		return false
+	}
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -112,6 +238,14 @@ func evalInfixExpression(operator string, left, right Object) Object {
 		return evalRegexInfixExpression(operator, left, right)
 	case (left.Type() == StringObject && right.Type() == RegexListObject):
 		return evalRegexListInfixExpression(operator, left, right)
+	case (left.Type() == NumberObject && right.Type() == RegexListObject):
+		return evalInListExpression(operator, left, right)
+	case (left.Type() == RegexListObject && (right.Type() == StringObject || right.Type() == NumberObject)):
+		return evalListContainsExpression(operator, left, right)
+	case isScalar(left) && isTypedList(right):
+		return evalListMatchExpression(operator, left, right.(List), false)
+	case isTypedList(left) && isScalar(right):
+		return evalListMatchExpression(operator, right, left.(List), true)
 	default:
 		return newError("invalid expression %q %q %q ", left, operator, right)
 	}
@@ -121,7 +255,7 @@ func evalLogicalInfixExpression(operator string, left, right Object) Object {
 	leftVal := left.(*Boolean).Value
 	rightVal := right.(*Boolean).Value
 
-	switch operator {
+	switch strings.ToLower(operator) {
 
 	case "and":
 		return &Boolean{Value: leftVal && rightVal}
@@ -142,6 +276,10 @@ func evalIntegerInfixExpression(operator string, left, right Object) Object {
 		return &Boolean{Value: leftVal < rightVal}
 	case ">":
 		return &Boolean{Value: leftVal > rightVal}
+	case "<=":
+		return &Boolean{Value: leftVal <= rightVal}
+	case ">=":
+		return &Boolean{Value: leftVal >= rightVal}
 	case "==":
 		return &Boolean{Value: leftVal == rightVal}
 	case "!=":
@@ -178,6 +316,17 @@ func evalStringInfixExpression(operator string, left, right Object) Object {
 	}
 }
 
+// Regex operators. A pattern p matches a string s when p finds a match,
+// possibly empty, anywhere in s. For a list L of patterns:
+//
+//	s CONTAINS L      some pattern of L matches s
+//	s ANY_MATCH L     same as CONTAINS
+//	s NOT_CONTAINS L  no pattern of L matches s
+//	s NONE_MATCH L    same as NOT_CONTAINS
+//	s ALL_MATCH L     every pattern of L matches s, true for an empty list
+//	s IN L            s is literally one of the entries of L
+//
+// A single regex behaves like a list holding only that pattern.
 func evalRegexInfixExpression(operator string, left, right Object) Object {
 	leftVal := left.(*String).Value
 	rightVal := right.(*Regex).Value
@@ -189,10 +338,10 @@ func evalRegexInfixExpression(operator string, left, right Object) Object {
 
 	switch strings.ToLower(operator) {
 
-	case "contains":
-		return &Boolean{Value: len(re.Find([]byte(leftVal))) > 0}
-	case "not_contains":
-		return &Boolean{Value: len(re.Find([]byte(leftVal))) == 0}
+	case "contains", "any_match", "all_match":
+		return &Boolean{Value: re.MatchString(leftVal)}
+	case "not_contains", "none_match":
+		return &Boolean{Value: !re.MatchString(leftVal)}
 	default:
 		return newError("invalid operator: %q", operator)
 	}
@@ -200,27 +349,65 @@ func evalRegexInfixExpression(operator string, left, right Object) Object {
 
 func evalRegexListInfixExpression(operator string, left, right Object) Object {
 	leftVal := left.(*String).Value
-	rightVal := right.(*RegexList).Value
+	list := right.(*RegexList)
 
 	switch strings.ToLower(operator) {
 
-	case "contains":
-		for _, re := range rightVal {
-			if len(re.Find([]byte(leftVal))) > 0 {
-				return &Boolean{Value: true}
+	case "contains", "any_match":
+		_, ok := list.MatchIndex(leftVal)
+		return &Boolean{Value: ok}
+	case "not_contains", "none_match":
+		_, ok := list.MatchIndex(leftVal)
+		return &Boolean{Value: !ok}
+	case "all_match":
+		for _, re := range list.Value {
+			if !re.MatchString(leftVal) {
+				return &Boolean{Value: false}
 			}
 		}
 
-		return &Boolean{Value: false}
-	case "not_contains":
-		for _, re := range rightVal {
-			if len(re.Find([]byte(leftVal))) == 0 {
-				return &Boolean{Value: true}
-			}
-		}
+		return &Boolean{Value: true}
+	case "in":
+		return &Boolean{Value: list.Has(leftVal)}
+	default:
+		return newError("invalid operator: %q", operator)
+	}
+}
+
+// evalInListExpression handles `value IN list`, which is true when the value
+// is one of the list entries
+func evalInListExpression(operator string, left, right Object) Object {
+	list := right.(*RegexList)
+
+	switch strings.ToLower(operator) {
+
+	case "in":
+		return &Boolean{Value: list.Has(listEntry(left))}
+	default:
+		return newError("invalid operator: %q", operator)
+	}
+}
+
+// evalListContainsExpression handles `list CONTAINS value`, the mirror of `value IN list`
+func evalListContainsExpression(operator string, left, right Object) Object {
+	list := left.(*RegexList)
 
-		return &Boolean{Value: false}
+	switch strings.ToLower(operator) {
+
+	case "contains":
+		return &Boolean{Value: list.Has(listEntry(right))}
+	case "not_contains":
+		return &Boolean{Value: !list.Has(listEntry(right))}
 	default:
 		return newError("invalid operator: %q", operator)
 	}
 }
+
+func listEntry(obj Object) string {
+	switch obj := obj.(type) {
+	case *Number:
+		return strconv.FormatFloat(obj.Value, 'f', -1, 64)
+	default:
+		return obj.Inspect()
+	}
+}
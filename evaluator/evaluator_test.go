@@ -68,6 +68,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -87,6 +91,12 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{`@list contains regex`, false},
 		{`regex contains list("a.*", "d")`, true},
 		{`a > b and a > b and a > b and a > b and a > b and a > b and a > b`, true},
+		{`a > b AND b > a`, false},
+		{`"ad" in @list`, true},
+		{`"a" in @list`, false},
+		{`8 in list(7, 8)`, true},
+		{`a IN list(7.5, "x")`, false},
+		{`@list contains "abd"`, true},
 	}
 
 	for _, tt := range tests {
@@ -142,3 +152,45 @@ func TestEvalIntegerExpression(t *testing.T) {
 		}
 	}
 }
+
+func TestRegexListOperators(t *testing.T) {
+	bindings := map[string]interface{}{
+		"email": "bob@spam.com",
+		"BLOCK": []string{`@spam\.com$`, `^admin@`},
+		"BOTH":  []string{`^bob`, `\.com$`},
+		"NONE":  []string{},
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// one of two patterns matches
+		{`email contains @BLOCK`, true},
+		{`email any_match @BLOCK`, true},
+		{`email not_contains @BLOCK`, false},
+		{`email none_match @BLOCK`, false},
+		{`email all_match @BLOCK`, false},
+		// every pattern matches
+		{`email not_contains @BOTH`, false},
+		{`email all_match @BOTH`, true},
+		// no pattern matches
+		{`"eve@example.org" contains @BLOCK`, false},
+		{`"eve@example.org" not_contains @BLOCK`, true},
+		{`"eve@example.org" none_match @BLOCK`, true},
+		{`"eve@example.org" all_match @BLOCK`, false},
+		// empty list
+		{`email contains @NONE`, false},
+		{`email not_contains @NONE`, true},
+		{`email all_match @NONE`, true},
+		// single regex
+		{`email any_match r"spam"`, true},
+		{`email all_match r"spam"`, true},
+		{`email none_match r"spam"`, false},
+		{`"b" contains r"a*"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input, bindings), tt.expected)
+	}
+}
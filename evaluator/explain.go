@@ -0,0 +1,64 @@
+package evaluator
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// Trace records the value of an evaluated node and of its children
+type Trace struct {
+	Node     string
+	Value    Object
+	Match    *ListMatch // set on the list operators that matched
+	Children []*Trace
+}
+
+// String renders the trace as an indented tree
+func (t *Trace) String() string {
+	var out bytes.Buffer
+	t.write(&out, 0)
+	return out.String()
+}
+
+func (t *Trace) write(out *bytes.Buffer, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	out.WriteString(t.Node)
+	out.WriteString(" => ")
+	if t.Value == nil {
+		out.WriteString("<nil>")
+	} else {
+		out.WriteString(t.Value.Inspect())
+	}
+	if t.Match != nil {
+		out.WriteString(" [")
+		if t.Match.List != "" {
+			out.WriteString("@" + t.Match.List + ": ")
+		}
+		out.WriteString(t.Match.Entry)
+		out.WriteString("]")
+	}
+	out.WriteString("\n")
+
+	for _, c := range t.Children {
+		c.write(out, depth+1)
+	}
+}
+
+// Explain evaluates node like Eval and RETURNS the trace of the evaluation
+func Explain(node parser.Node, env *Environment) (Object, *Trace) {
+	return (&evaluation{}).explain(node, env)
+}
+
+func (e *evaluation) explain(node parser.Node, env *Environment) (Object, *Trace) {
+	root := &Trace{}
+	e.trace, e.recordMatches = root, true
+	obj := e.eval(node, env)
+
+	if len(root.Children) == 0 {
+		return obj, &Trace{Node: node.String(), Value: obj}
+	}
+
+	return obj, root.Children[0]
+}
@@ -1,35 +1,295 @@
 package evaluator
 
 import (
+	containerlist "container/list"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/zain-bahsarat/rule_egine/parser"
 )
 
 const (
-	ListFN = "LIST"
+	ListFN       = "LIST"
+	MatchesFN    = "MATCHES"
+	ExtractFN    = "EXTRACT"
+	ExtractAllFN = "EXTRACT_ALL"
+	ReplaceReFN  = "REPLACE_RE"
 )
 
-type nativeFn func(args interface{}) (interface{}, error)
+// Function is a function callable from rules, it receives the evaluated
+// arguments of the call
+type Function func(args []Object) (Object, error)
+
+// ContextFunction is a function receiving the context of the evaluation
+// calling it, e.g. to read values attached by the caller of EvalContext
+type ContextFunction func(ctx context.Context, args []Object) (Object, error)
+
+type callKey struct{}
+
+// CallFrom RETURNS the call expression being evaluated when a
+// ContextFunction receives ctx, e.g. to tell apart calls whose arguments
+// evaluate to the same values
+func CallFrom(ctx context.Context) (*parser.CallExpression, bool) {
+	call, ok := ctx.Value(callKey{}).(*parser.CallExpression)
+	return call, ok
+}
+
+func (fn Function) withContext() ContextFunction {
+	return func(_ context.Context, args []Object) (Object, error) {
+		return fn(args)
+	}
+}
 
 var (
-	nativeFns = make(map[string]nativeFn)
+	// builtin functions of every engine, never written after initialization
+	nativeFns = bindNativeFns(map[string]Function{
+		ListFN:       list,
+		MatchesFN:    matches,
+		ExtractFN:    extract,
+		ExtractAllFN: extractAll,
+		ReplaceReFN:  replaceRe,
+	})
+
+	// functions matching a regex against their first argument
+	regexFns = map[string]bool{
+		strings.ToLower(MatchesFN):    true,
+		strings.ToLower(ExtractFN):    true,
+		strings.ToLower(ExtractAllFN): true,
+		strings.ToLower(ReplaceReFN):  true,
+	}
 )
 
 type Stringable interface {
 	String() string
 }
 
-func bindNativeFns(name string, fn nativeFn) {
-	name = strings.ToLower(name)
-	nativeFns[name] = fn
+// bindNativeFns RETURNS the functions keyed by their lowercased name
+func bindNativeFns(fns map[string]Function) map[string]ContextFunction {
+	bound := make(map[string]ContextFunction, len(fns))
+	for name, fn := range fns {
+		bound[strings.ToLower(name)] = fn.withContext()
+	}
+
+	return bound
 }
 
-func list(args interface{}) (interface{}, error) {
+func list(args []Object) (Object, error) {
 	list := make([]string, 0)
-	for _, arg := range args.([]parser.Expression) {
-		list = append(list, arg.TokenLiteral())
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case *Regex:
+			list = append(list, arg.Value)
+		case *String, *Number:
+			list = append(list, listEntry(arg))
+		default:
+			return nil, fmt.Errorf("invalid list entry: %s", arg.Inspect())
+		}
 	}
 
 	return NewRegexList(list), nil
 }
+
+// matches(s, re) reports whether re matches s
+func matches(args []Object) (Object, error) {
+	s, re, err := regexArgs(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Boolean{Value: re.MatchString(s)}, nil
+}
+
+// extract(s, re, group) RETURNS the group of the first match of re in s,
+// group is a number or the name of a named group. Without a match the
+// result is an empty string
+func extract(args []Object) (Object, error) {
+	s, re, err := regexArgs(args, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := groupIndex(re, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return &String{Value: ""}, nil
+	}
+
+	return &String{Value: m[group]}, nil
+}
+
+// extract_all(s, re[, group]) RETURNS the group of every match of re in s,
+// the whole match by default
+func extractAll(args []Object) (Object, error) {
+	s, re, err := regexArgs(args, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	group := 0
+	if len(args) == 3 {
+		if group, err = groupIndex(re, args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]string, 0)
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		values = append(values, m[group])
+	}
+
+	return NewStringList(values), nil
+}
+
+// replace_re(s, re, replacement) replaces the matches of re in s, the
+// replacement can reference groups with $1 or ${name}
+func replaceRe(args []Object) (Object, error) {
+	s, re, err := regexArgs(args, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	repl, ok := args[2].(*String)
+	if !ok {
+		return nil, fmt.Errorf("replacement must be a string, got %s", args[2].Type())
+	}
+
+	return &String{Value: re.ReplaceAllString(s, repl.Value)}, nil
+}
+
+// regexArgs checks the argument count and RETURNS the subject string and
+// the compiled pattern of the first two arguments
+func regexArgs(args []Object, min, max int) (string, *regexp.Regexp, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return "", nil, fmt.Errorf("expected %d arguments, got %d", min, len(args))
+		}
+		return "", nil, fmt.Errorf("expected %d to %d arguments, got %d", min, max, len(args))
+	}
+
+	s, ok := args[0].(*String)
+	if !ok {
+		return "", nil, fmt.Errorf("subject must be a string, got %s", args[0].Type())
+	}
+
+	var pattern string
+	switch p := args[1].(type) {
+	case *Regex:
+		pattern = p.Value
+	case *String:
+		pattern = p.Value
+	default:
+		return "", nil, fmt.Errorf("pattern must be a regex, got %s", args[1].Type())
+	}
+
+	re, err := cachedRegex(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.Value, re, nil
+}
+
+func groupIndex(re *regexp.Regexp, arg Object) (int, error) {
+	switch g := arg.(type) {
+	case *Number:
+		i := int(g.Value)
+		if float64(i) != g.Value || i < 0 || i > re.NumSubexp() {
+			return 0, fmt.Errorf("invalid group: %s", strconv.FormatFloat(g.Value, 'f', -1, 64))
+		}
+		return i, nil
+	case *String:
+		if i := re.SubexpIndex(g.Value); i >= 0 {
+			return i, nil
+		}
+		return 0, fmt.Errorf("unknown group: %q", g.Value)
+	default:
+		return 0, fmt.Errorf("group must be a number or a name, got %s", arg.Type())
+	}
+}
+
+// maximum number of compiled patterns kept, the patterns can come from the
+// input so the cache is bounded
+const maxCachedRegexes = 1024
+
+var regexCache = newRegexLRU(maxCachedRegexes)
+
+func cachedRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.get(pattern); ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %q", pattern)
+	}
+
+	regexCache.add(pattern, re)
+	return re, nil
+}
+
+// regexLRU keeps the most recently used compiled patterns
+type regexLRU struct {
+	mtx      *sync.Mutex
+	capacity int
+	order    *containerlist.List // of *regexEntry, most recent first
+	entries  map[string]*containerlist.Element
+}
+
+type regexEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRegexLRU(capacity int) *regexLRU {
+	return &regexLRU{
+		mtx:      &sync.Mutex{},
+		capacity: capacity,
+		order:    containerlist.New(),
+		entries:  make(map[string]*containerlist.Element),
+	}
+}
+
+func (c *regexLRU) get(pattern string) (*regexp.Regexp, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	el, ok := c.entries[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+
+	return el.Value.(*regexEntry).re, true
+}
+
+func (c *regexLRU) add(pattern string, re *regexp.Regexp) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if el, ok := c.entries[pattern]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[pattern] = c.order.PushFront(&regexEntry{pattern: pattern, re: re})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*regexEntry).pattern)
+	}
+}
+
+func (c *regexLRU) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.order.Len()
+}
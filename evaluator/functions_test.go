@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexFunctions(t *testing.T) {
+	bindings := map[string]interface{}{
+		"url":   "https://shop.example.com/?utm_source=newsletter&utm_medium=email",
+		"email": "bob@example.com",
+		"text":  "a1 b22 c333",
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`matches(email, r"@example\.com$")`, true},
+		{`matches(email, "^alice")`, false},
+		{`MATCHES(email, r"^bob")`, true},
+		{`extract(url, r"utm_source=(\w+)", 1) == "newsletter"`, true},
+		{`extract(url, r"utm_medium=(?P<medium>\w+)", "medium") == "email"`, true},
+		{`extract(url, r"utm_campaign=(\w+)", 1) == ""`, true},
+		{`extract(email, r"^(\w+)@", 0) == "bob@"`, true},
+		{`extract_all(text, r"[a-z](\d+)", 1) contains "22"`, true},
+		{`extract_all(text, r"\d+") contains "4"`, false},
+		{`replace_re(email, r"^(?P<user>\w+)@(.*)$", "${2}/${user}") == "example.com/bob"`, true},
+		{`extract(replace_re(text, r"\d", "#"), r"c(#+)", 1) == "###"`, true},
+	}
+
+	for i, tt := range tests {
+		obj := testEval(t, tt.input, bindings)
+		if !testBooleanObject(t, obj, tt.expected) {
+			t.Logf("tests[%d] - %s", i, obj.Inspect())
+		}
+	}
+}
+
+func TestRegexFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`matches("a")`, "matches: expected 2 arguments, got 1"},
+		{`matches(1, "a")`, "matches: subject must be a string, got Number"},
+		{`matches("a", "(")`, `matches: invalid regex: "("`},
+		{`extract("a", "(a)", 2)`, "extract: invalid group: 2"},
+		{`extract("a", "(a)", "name")`, `extract: unknown group: "name"`},
+		{`extract_all("a", "a", 0, 1)`, "extract_all: expected 2 to 3 arguments, got 4"},
+		{`replace_re("a", "a", 1)`, "replace_re: replacement must be a string, got Number"},
+		{`unknown("a")`, "undefined function: unknown"},
+	}
+
+	for i, tt := range tests {
+		obj := testEval(t, tt.input, map[string]interface{}{})
+		errObj, ok := obj.(*Error)
+		if !assert.True(t, ok, fmt.Sprintf("tests[%d] - got %T", i, obj)) {
+			continue
+		}
+		assert.Equal(t, tt.err, errObj.Message, fmt.Sprintf("tests[%d]", i))
+	}
+}
+
+func TestRegexCacheBounded(t *testing.T) {
+	cache := newRegexLRU(2)
+	for _, pattern := range []string{"a", "b", "a", "c"} {
+		if _, ok := cache.get(pattern); !ok {
+			cache.add(pattern, regexp.MustCompile(pattern))
+		}
+	}
+	assert.Equal(t, 2, cache.len())
+
+	// the least recently used pattern is evicted
+	_, ok := cache.get("b")
+	assert.False(t, ok)
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+	_, ok = cache.get("c")
+	assert.True(t, ok)
+
+	// patterns coming from the input never grow the shared cache past its cap
+	for i := 0; i < maxCachedRegexes+10; i++ {
+		_, err := cachedRegex(fmt.Sprintf("^p%d$", i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, maxCachedRegexes, regexCache.len())
+}
@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// ErrorCode identifies the kind of failure of a rule
+type ErrorCode string
+
+const (
+	// CodeEval is a plain evaluation error, e.g. a type mismatch
+	CodeEval         ErrorCode = "eval"
+	CodeSourceLength ErrorCode = "source_length"
+	CodeDepth        ErrorCode = "ast_depth"
+	CodeNodes        ErrorCode = "node_count"
+	CodeSteps        ErrorCode = "eval_steps"
+	CodeInputSize    ErrorCode = "input_size"
+	// the context of the evaluation was cancelled or its deadline passed
+	CodeCancelled ErrorCode = "cancelled"
+	CodeTimeout   ErrorCode = "timeout"
+)
+
+// RuleError is returned when a rule breaks a limit or fails to evaluate
+type RuleError struct {
+	Code    ErrorCode
+	Message string
+	// context.Canceled or context.DeadlineExceeded for the context codes
+	Err error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Limits bounds the resources used to parse and evaluate a rule. Zero
+// values mean no limit
+type Limits struct {
+	MaxSourceLength int // bytes of the expression
+	MaxDepth        int // nesting of the AST
+	MaxNodes        int // nodes of the AST
+	MaxSteps        int // nodes visited by one evaluation
+	MaxRegexInput   int // bytes of a string matched against a regex
+}
+
+// DefaultLimits are the limits of the rules created with NewRule
+var DefaultLimits = Limits{
+	MaxSourceLength: 1 << 20,
+	MaxDepth:        1000,
+	MaxNodes:        100000,
+	MaxSteps:        1000000,
+	MaxRegexInput:   1 << 20,
+}
+
+// NoLimits disables every limit
+var NoLimits = Limits{}
+
+// parse parses the expression within the source length, depth and node limits
+func (l Limits) parse(expression string, trace io.Writer) (*parser.Rule, error) {
+	if l.MaxSourceLength > 0 && len(expression) > l.MaxSourceLength {
+		return nil, &RuleError{Code: CodeSourceLength, Message: fmt.Sprintf("expression is %d bytes, limit is %d", len(expression), l.MaxSourceLength)}
+	}
+
+	p := parser.New(parser.NewLexer(expression))
+	p.SetMaxDepth(l.MaxDepth)
+	p.SetTrace(trace)
+	rule := p.ParseRule()
+	if p.DepthExceeded() {
+		return nil, &RuleError{Code: CodeDepth, Message: fmt.Sprintf("expression nested deeper than %d levels", l.MaxDepth)}
+	}
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	// chains of infix operators are parsed iteratively, so the depth of
+	// the tree is checked again
+	depth, nodes := astSize(rule)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return nil, &RuleError{Code: CodeDepth, Message: fmt.Sprintf("expression nested deeper than %d levels", l.MaxDepth)}
+	}
+	if l.MaxNodes > 0 && nodes > l.MaxNodes {
+		return nil, &RuleError{Code: CodeNodes, Message: fmt.Sprintf("expression has %d nodes, limit is %d", nodes, l.MaxNodes)}
+	}
+
+	return rule, nil
+}
+
+// astSize RETURNS the depth and the number of expression nodes of node
+func astSize(node parser.Node) (int, int) {
+	var children []parser.Node
+
+	switch node := node.(type) {
+	case *parser.Rule:
+		return astSize(node.Statement)
+	case *parser.ExpressionStatement:
+		if node.Expression == nil {
+			return 0, 0
+		}
+		return astSize(node.Expression)
+	case *parser.PrefixExpression:
+		children = []parser.Node{node.Right}
+	case *parser.InfixExpression:
+		children = []parser.Node{node.Left, node.Right}
+	case *parser.CallExpression:
+		children = []parser.Node{node.Function}
+		for _, a := range node.Arguments {
+			children = append(children, a)
+		}
+	}
+
+	depth, nodes := 0, 1
+	for _, c := range children {
+		if c == nil {
+			continue
+		}
+		d, n := astSize(c)
+		if d > depth {
+			depth = d
+		}
+		nodes += n
+	}
+
+	return depth + 1, nodes
+}
+
+// step counts a node visit against the step limit
+func (e *evaluation) step() *Error {
+	if e.limits.MaxSteps <= 0 {
+		return nil
+	}
+
+	e.steps++
+	if e.steps > e.limits.MaxSteps {
+		e.err = &Error{Code: CodeSteps, Message: fmt.Sprintf("evaluation exceeded %d steps", e.limits.MaxSteps)}
+	}
+
+	return e.err
+}
+
+// interrupted stops the evaluation once its context is done
+func (e *evaluation) interrupted() *Error {
+	if e.err != nil || e.ctx == nil {
+		return e.err
+	}
+
+	switch err := e.ctx.Err(); {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		e.err = &Error{Code: CodeTimeout, Message: "evaluation deadline exceeded"}
+	default:
+		e.err = &Error{Code: CodeCancelled, Message: "evaluation cancelled"}
+	}
+
+	return e.err
+}
+
+func (e *evaluation) context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// checkRegexInput fails when s is matched against a pattern and is larger
+// than the regex input limit
+func (e *evaluation) checkRegexInput(s Object) *Error {
+	str, ok := s.(*String)
+	if !ok || e.limits.MaxRegexInput <= 0 || len(str.Value) <= e.limits.MaxRegexInput {
+		return nil
+	}
+
+	return &Error{Code: CodeInputSize, Message: fmt.Sprintf("regex input is %d bytes, limit is %d", len(str.Value), e.limits.MaxRegexInput)}
+}
+
+// toRuleError converts the result of an evaluation to an error
+func toRuleError(obj Object) error {
+	switch obj := obj.(type) {
+	case *Error:
+		code := obj.Code
+		if code == "" {
+			code = CodeEval
+		}
+		err := &RuleError{Code: code, Message: obj.Message}
+		switch code {
+		case CodeTimeout:
+			err.Err = context.DeadlineExceeded
+		case CodeCancelled:
+			err.Err = context.Canceled
+		}
+		return err
+	case nil:
+		return &RuleError{Code: CodeEval, Message: "no result"}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits := Limits{MaxSourceLength: 200, MaxDepth: 10, MaxNodes: 20}
+
+	testcases := []struct {
+		expr string
+		code ErrorCode
+	}{
+		{`a == 1`, ""},
+		{strings.Repeat("(", 11) + "a" + strings.Repeat(")", 11), CodeDepth},
+		{strings.Repeat("(", 50), CodeDepth},
+		{strings.Repeat("- ", 20) + "1", CodeDepth},
+		{`a` + strings.Repeat(` and a`, 11), CodeDepth},
+		{`f(a, b, c, d, e) and g(a, b, c, d, e) and h(a, b, c, d, e)`, CodeNodes},
+		{`a == "` + strings.Repeat("x", 200) + `"`, CodeSourceLength},
+	}
+
+	for i, tt := range testcases {
+		_, err := NewRuleWithLimits(tt.expr, nil, limits)
+		if tt.code == "" {
+			assert.NoError(t, err, fmt.Sprintf("tests[%d]", i))
+			continue
+		}
+
+		var re *RuleError
+		if assert.True(t, errors.As(err, &re), fmt.Sprintf("tests[%d] - %v", i, err)) {
+			assert.Equal(t, tt.code, re.Code, fmt.Sprintf("tests[%d]", i))
+		}
+	}
+
+	// syntax errors are reported as before
+	_, err := NewRuleWithLimits(`a ==`, nil, limits)
+	assert.EqualError(t, err, "no prefix parse function for EOF found")
+
+	// unterminated strings stop at the end of the input
+	_, err = NewRule(`a == "abc`, nil)
+	assert.NoError(t, err)
+}
+
+func TestEvalLimits(t *testing.T) {
+	limits := Limits{MaxSteps: 10, MaxRegexInput: 16}
+
+	testcases := []struct {
+		expr   string
+		params map[string]interface{}
+		result bool
+		code   ErrorCode
+	}{
+		{`a == 1 and b == 2`, map[string]interface{}{"a": 1, "b": 2}, true, ""},
+		{`a == 1 and b == 2 and c == 3 and d == 4`, map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4}, false, CodeSteps},
+		{`s contains r"b$"`, map[string]interface{}{"s": "ab"}, true, ""},
+		{`s contains r"b$"`, map[string]interface{}{"s": strings.Repeat("a", 17)}, false, CodeInputSize},
+		{`s not_contains list("a", "b")`, map[string]interface{}{"s": strings.Repeat("a", 17)}, false, CodeInputSize},
+		{`matches(s, "b$")`, map[string]interface{}{"s": strings.Repeat("a", 17)}, false, CodeInputSize},
+		{`s == t`, map[string]interface{}{"s": strings.Repeat("a", 17), "t": strings.Repeat("a", 17)}, true, ""},
+		{`a == 1`, map[string]interface{}{}, false, CodeEval},
+	}
+
+	for i, tt := range testcases {
+		r, err := NewRuleWithLimits(tt.expr, nil, limits)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		res, err := r.Evaluate(tt.params)
+		assert.Equal(t, tt.result, res, fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.result, r.Eval(tt.params), fmt.Sprintf("tests[%d]", i))
+		if tt.code == "" {
+			assert.NoError(t, err, fmt.Sprintf("tests[%d]", i))
+			continue
+		}
+
+		var re *RuleError
+		if assert.True(t, errors.As(err, &re), fmt.Sprintf("tests[%d] - %v", i, err)) {
+			assert.Equal(t, tt.code, re.Code, fmt.Sprintf("tests[%d]", i))
+		}
+	}
+}
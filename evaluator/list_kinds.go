@@ -0,0 +1,417 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	StringListObject = "StringList"
+	NumberListObject = "NumberList"
+	CIDRListObject   = "CIDRList"
+	PrefixListObject = "PrefixList"
+)
+
+type ListKind string
+
+const (
+	RegexKind  ListKind = "regex"  // entries are regular expressions
+	ExactKind  ListKind = "exact"  // entries are compared literally
+	NumberKind ListKind = "number" // entries are numbers
+	CIDRKind   ListKind = "cidr"   // entries are IP addresses or CIDR ranges
+	PrefixKind ListKind = "prefix" // entries are string prefixes
+)
+
+// List is implemented by the list objects. `value CONTAINS @LIST` and
+// `value IN @LIST` are true when Match finds an entry for the value
+type List interface {
+	Object
+	// Match RETURNS the entry matching value
+	Match(value Object) (string, bool)
+	Len() int
+}
+
+// NewList builds a list of the given kind. Unlike NewRegexList invalid
+// entries are reported
+func NewList(kind ListKind, values []string) (Object, error) {
+	switch kind {
+	case RegexKind, "":
+		patterns := make([]*regexp.Regexp, 0, len(values))
+		for _, v := range values {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex: %q", v)
+			}
+			patterns = append(patterns, re)
+		}
+		return &RegexList{Value: patterns}, nil
+	case ExactKind:
+		return NewStringList(values), nil
+	case NumberKind:
+		numbers := make([]float64, 0, len(values))
+		for _, v := range values {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number: %q", v)
+			}
+			numbers = append(numbers, n)
+		}
+		return NewNumberList(numbers), nil
+	case CIDRKind:
+		return NewCIDRList(values)
+	case PrefixKind:
+		return NewPrefixList(values), nil
+	default:
+		return nil, fmt.Errorf("unknown list kind: %q", kind)
+	}
+}
+
+// StringList is a hash set of strings
+type StringList struct {
+	Values []string
+	set    map[string]struct{}
+}
+
+func NewStringList(values []string) *StringList {
+	l := &StringList{Values: values, set: make(map[string]struct{}, len(values))}
+	for _, v := range values {
+		l.set[v] = struct{}{}
+	}
+
+	return l
+}
+
+func (l *StringList) Type() ObjectType { return StringListObject }
+func (l *StringList) Inspect() string  { return fmt.Sprintf("%q", l.Values) }
+func (l *StringList) Len() int         { return len(l.Values) }
+
+func (l *StringList) Match(value Object) (string, bool) {
+	v := listEntry(value)
+	_, ok := l.set[v]
+	return v, ok
+}
+
+// NumberList is a hash set of numbers, strings holding numbers match too
+type NumberList struct {
+	Values []float64
+	set    map[float64]struct{}
+}
+
+func NewNumberList(values []float64) *NumberList {
+	l := &NumberList{Values: values, set: make(map[float64]struct{}, len(values))}
+	for _, v := range values {
+		l.set[v] = struct{}{}
+	}
+
+	return l
+}
+
+func (l *NumberList) Type() ObjectType { return NumberListObject }
+func (l *NumberList) Inspect() string  { return fmt.Sprintf("%v", l.Values) }
+func (l *NumberList) Len() int         { return len(l.Values) }
+
+func (l *NumberList) Match(value Object) (string, bool) {
+	n, ok := listNumber(value)
+	if !ok {
+		return "", false
+	}
+
+	_, ok = l.set[n]
+	return strconv.FormatFloat(n, 'f', -1, 64), ok
+}
+
+// listNumber RETURNS the number held by a number or a string
+func listNumber(value Object) (float64, bool) {
+	switch value := value.(type) {
+	case *Number:
+		return value.Value, true
+	case *String:
+		n, err := strconv.ParseFloat(value.Value, 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// CIDRList holds IP ranges. Lookups are a binary search over the ranges
+// sorted by first address; nested ranges link to their parent so the most
+// specific range is found first
+type CIDRList struct {
+	Values   []string
+	prefixes []netip.Prefix
+	entries  []string
+	parents  []int
+}
+
+func NewCIDRList(values []string) (*CIDRList, error) {
+	type entry struct {
+		prefix netip.Prefix
+		value  string
+	}
+
+	entries := make([]entry, 0, len(values))
+	for _, v := range values {
+		s := strings.TrimSpace(v)
+
+		var p netip.Prefix
+		if strings.Contains(s, "/") {
+			var err error
+			if p, err = netip.ParsePrefix(s); err != nil {
+				return nil, fmt.Errorf("invalid CIDR: %q", v)
+			}
+		} else {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP: %q", v)
+			}
+			addr = addr.Unmap()
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		entries = append(entries, entry{prefix: p.Masked(), value: v})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if c := entries[i].prefix.Addr().Compare(entries[j].prefix.Addr()); c != 0 {
+			return c < 0
+		}
+		return entries[i].prefix.Bits() < entries[j].prefix.Bits()
+	})
+
+	l := &CIDRList{Values: values}
+	stack := make([]int, 0)
+	for i, e := range entries {
+		for len(stack) > 0 && !entries[stack[len(stack)-1]].prefix.Contains(e.prefix.Addr()) {
+			stack = stack[:len(stack)-1]
+		}
+
+		parent := -1
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		l.prefixes = append(l.prefixes, e.prefix)
+		l.entries = append(l.entries, e.value)
+		l.parents = append(l.parents, parent)
+		stack = append(stack, i)
+	}
+
+	return l, nil
+}
+
+func (l *CIDRList) Type() ObjectType { return CIDRListObject }
+func (l *CIDRList) Inspect() string  { return fmt.Sprintf("%q", l.Values) }
+func (l *CIDRList) Len() int         { return len(l.Values) }
+
+func (l *CIDRList) Match(value Object) (string, bool) {
+	addr, ok := listAddr(value)
+	if !ok {
+		return "", false
+	}
+
+	i := sort.Search(len(l.prefixes), func(i int) bool {
+		return l.prefixes[i].Addr().Compare(addr) > 0
+	}) - 1
+
+	for ; i >= 0; i = l.parents[i] {
+		if l.prefixes[i].Contains(addr) {
+			return l.entries[i], true
+		}
+	}
+
+	return "", false
+}
+
+// listAddr RETURNS the IP address held by a string
+func listAddr(value Object) (netip.Addr, bool) {
+	s, ok := value.(*String)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	addr, err := netip.ParseAddr(s.Value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
+
+type trieNode struct {
+	children map[byte]*trieNode
+	terminal bool
+}
+
+// PrefixList matches strings starting with one of its entries, the longest
+// matching entry is reported
+type PrefixList struct {
+	Values []string
+	root   *trieNode
+}
+
+func NewPrefixList(values []string) *PrefixList {
+	l := &PrefixList{Values: values, root: &trieNode{}}
+	for _, v := range values {
+		n := l.root
+		for i := 0; i < len(v); i++ {
+			if n.children == nil {
+				n.children = make(map[byte]*trieNode)
+			}
+
+			next, ok := n.children[v[i]]
+			if !ok {
+				next = &trieNode{}
+				n.children[v[i]] = next
+			}
+			n = next
+		}
+		n.terminal = true
+	}
+
+	return l
+}
+
+func (l *PrefixList) Type() ObjectType { return PrefixListObject }
+func (l *PrefixList) Inspect() string  { return fmt.Sprintf("%q", l.Values) }
+func (l *PrefixList) Len() int         { return len(l.Values) }
+
+func (l *PrefixList) Match(value Object) (string, bool) {
+	s := listEntry(value)
+
+	longest := -1
+	n := l.root
+	if n.terminal {
+		longest = 0
+	}
+
+	for i := 0; i < len(s); i++ {
+		next, ok := n.children[s[i]]
+		if !ok {
+			break
+		}
+
+		n = next
+		if n.terminal {
+			longest = i + 1
+		}
+	}
+
+	if longest < 0 {
+		return "", false
+	}
+
+	return s[:longest], true
+}
+
+// ListKinds is implemented by list providers choosing the kind of their lists
+type ListKinds interface {
+	ListKind(name string) ListKind
+}
+
+type kindedProvider struct {
+	ListProvider
+	kinds map[string]ListKind
+}
+
+func (p *kindedProvider) ListKind(name string) ListKind {
+	return p.kinds[name]
+}
+
+func (p *kindedProvider) ListContext(ctx context.Context, name string) ([]string, error) {
+	return fetchList(ctx, p.ListProvider, name)
+}
+
+// WithListKinds sets the kind of the lists served by provider, lists
+// missing from kinds are regex lists
+func WithListKinds(provider ListProvider, kinds map[string]ListKind) ListProvider {
+	return &kindedProvider{ListProvider: provider, kinds: kinds}
+}
+
+// evalListMatchExpression handles `value CONTAINS list`, `value IN list`
+// and the match operators for the typed lists, and `list CONTAINS value`
+// when mirrored. Like for the regex lists ANY_MATCH is CONTAINS, NONE_MATCH
+// is NOT_CONTAINS and ALL_MATCH is true when every entry matches the value
+func evalListMatchExpression(operator string, value Object, list List, mirrored bool) Object {
+	switch op := strings.ToLower(operator); {
+
+	case op == "contains" || (!mirrored && (op == "in" || op == "any_match")):
+		_, ok := list.Match(value)
+		return &Boolean{Value: ok}
+	case op == "not_contains" || (!mirrored && op == "none_match"):
+		_, ok := list.Match(value)
+		return &Boolean{Value: !ok}
+	case op == "all_match" && !mirrored:
+		return &Boolean{Value: allMatch(value, list)}
+	default:
+		return newError("invalid operator: %q", operator)
+	}
+}
+
+// allMatch reports whether every entry of list matches value, true for an
+// empty list
+func allMatch(value Object, list List) bool {
+	if list.Len() == 0 {
+		return true
+	}
+
+	switch l := list.(type) {
+	case *StringList:
+		v := listEntry(value)
+		for _, entry := range l.Values {
+			if entry != v {
+				return false
+			}
+		}
+		return true
+	case *NumberList:
+		n, ok := listNumber(value)
+		if !ok {
+			return false
+		}
+		for _, entry := range l.Values {
+			if entry != n {
+				return false
+			}
+		}
+		return true
+	case *CIDRList:
+		addr, ok := listAddr(value)
+		if !ok {
+			return false
+		}
+		for _, p := range l.prefixes {
+			if !p.Contains(addr) {
+				return false
+			}
+		}
+		return true
+	case *PrefixList:
+		v := listEntry(value)
+		for _, entry := range l.Values {
+			if !strings.HasPrefix(v, entry) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func isTypedList(obj Object) bool {
+	switch obj.(type) {
+	case *StringList, *NumberList, *CIDRList, *PrefixList:
+		return true
+	default:
+		return false
+	}
+}
+
+func isScalar(obj Object) bool {
+	return obj.Type() == StringObject || obj.Type() == NumberObject
+}
@@ -0,0 +1,180 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedLists(t *testing.T) {
+	cidrs, err := NewCIDRList([]string{"10.0.0.0/8", "10.1.0.0/16", "192.168.1.7", "2001:db8::/32"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bindings := map[string]interface{}{
+		"email":  "a.b+c@example.com",
+		"sku":    "A-100",
+		"code":   42,
+		"ip":     "10.1.2.3",
+		"url":    "https://shop.example.com/cart",
+		"EMAILS": NewStringList([]string{"a.b+c@example.com", "x@y.z"}),
+		"REGEX":  []string{"a.b+c@example.com"},
+		"CODES":  []int{7, 42},
+		"IPS":    cidrs,
+		"URLS":   NewPrefixList([]string{"https://shop.", "http://"}),
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`email contains @EMAILS`, true},
+		{`email in @EMAILS`, true},
+		{`"a.bbc@example.com" contains @EMAILS`, false},
+		// regex lists treat the entry as a pattern
+		{`"a.bbc@example.com" contains @REGEX`, true},
+		{`email not_contains @EMAILS`, false},
+		{`@EMAILS contains email`, true},
+		{`code in @CODES`, true},
+		{`"7" in @CODES`, true},
+		{`8 in @CODES`, false},
+		{`ip in @IPS`, true},
+		{`"10.200.0.1" in @IPS`, true},
+		{`"11.0.0.1" in @IPS`, false},
+		{`"192.168.1.7" in @IPS`, true},
+		{`"192.168.1.8" in @IPS`, false},
+		{`"2001:db8::1" in @IPS`, true},
+		{`"not an ip" in @IPS`, false},
+		{`url contains @URLS`, true},
+		{`"ftp://shop." contains @URLS`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input, bindings), tt.expected)
+	}
+}
+
+func TestTypedListMatchOperators(t *testing.T) {
+	cidrs, err := NewCIDRList([]string{"10.0.0.0/8", "10.1.0.0/16"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bindings := map[string]interface{}{
+		"ip":     "10.1.2.3",
+		"url":    "https://shop.example.com/cart",
+		"EMAILS": NewStringList([]string{"a@b.c", "x@y.z"}),
+		"ONE":    NewStringList([]string{"a@b.c"}),
+		"EMPTY":  NewStringList(nil),
+		"CODES":  []int{7, 42},
+		"IPS":    cidrs,
+		"URLS":   NewPrefixList([]string{"https://", "https://shop."}),
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a@b.c" any_match @EMAILS`, true},
+		{`"q@b.c" any_match @EMAILS`, false},
+		{`"a@b.c" none_match @EMAILS`, false},
+		{`"q@b.c" none_match @EMAILS`, true},
+		{`"a@b.c" all_match @EMAILS`, false},
+		{`"a@b.c" all_match @ONE`, true},
+		{`"a@b.c" all_match @EMPTY`, true},
+		{`42 any_match @CODES`, true},
+		{`"42" none_match @CODES`, false},
+		{`42 all_match @CODES`, false},
+		{`ip all_match @IPS`, true},
+		{`"10.2.0.1" all_match @IPS`, false},
+		{`"10.2.0.1" any_match @IPS`, true},
+		{`"11.0.0.1" none_match @IPS`, true},
+		{`url all_match @URLS`, true},
+		{`"https://www." all_match @URLS`, false},
+		{`"https://www." any_match @URLS`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input, bindings), tt.expected)
+	}
+}
+
+func TestListMatchEntry(t *testing.T) {
+	cidrs, _ := NewCIDRList([]string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16"})
+	prefixes := NewPrefixList([]string{"ab", "abcd", "x"})
+
+	testcases := []struct {
+		list    List
+		value   string
+		entry   string
+		matched bool
+	}{
+		{cidrs, "10.1.2.3", "10.1.2.0/24", true},
+		{cidrs, "10.1.3.3", "10.1.0.0/16", true},
+		{cidrs, "10.3.0.1", "10.0.0.0/8", true},
+		{cidrs, "::ffff:10.2.0.1", "10.2.0.0/16", true},
+		{prefixes, "abcde", "abcd", true},
+		{prefixes, "abc", "ab", true},
+		{prefixes, "a", "", false},
+	}
+
+	for i, tt := range testcases {
+		entry, ok := tt.list.Match(&String{Value: tt.value})
+		assert.Equal(t, tt.matched, ok, fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.entry, entry, fmt.Sprintf("tests[%d]", i))
+	}
+}
+
+func TestListKindsFromProvider(t *testing.T) {
+	p := WithListKinds(NewMemoryListProvider(map[string][]string{
+		"SKUS":   {"A.1", "B+2"},
+		"BAD":    {"not a number"},
+		"PLAIN":  {"A.1"},
+		"RANGES": {"10.0.0.0/8"},
+	}), map[string]ListKind{"SKUS": ExactKind, "BAD": NumberKind, "RANGES": CIDRKind})
+
+	testcases := []struct {
+		expr     string
+		params   map[string]interface{}
+		expected bool
+		err      bool
+	}{
+		{`sku in @SKUS`, map[string]interface{}{"sku": "A.1"}, true, false},
+		{`sku in @SKUS`, map[string]interface{}{"sku": "AX1"}, false, false},
+		{`sku contains @PLAIN`, map[string]interface{}{"sku": "AX1"}, true, false},
+		{`ip in @RANGES`, map[string]interface{}{"ip": "10.9.9.9"}, true, false},
+		{`n in @BAD`, map[string]interface{}{"n": 1}, false, true},
+	}
+
+	for i, tt := range testcases {
+		r, err := NewRule(tt.expr, map[string]interface{}{})
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		res, err := r.EvalWithLists(tt.params, p)
+		assert.Equal(t, tt.err, err != nil, fmt.Sprintf("tests[%d] - %v", i, err))
+		assert.Equal(t, tt.expected, res, fmt.Sprintf("tests[%d]", i))
+	}
+
+	_, err := NewList(RegexKind, []string{"("})
+	assert.Error(t, err)
+	_, err = NewList("bloom", nil)
+	assert.Error(t, err)
+}
+
+func BenchmarkStringListMatch(b *testing.B) {
+	values := make([]string, 100000)
+	for i := range values {
+		values[i] = fmt.Sprintf("user%d@example.com", i)
+	}
+	l := NewStringList(values)
+	v := &String{Value: "user99999@example.com"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Match(v)
+	}
+}
@@ -0,0 +1,243 @@
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrListNotFound = errors.New("list not found")
+
+// ListProvider resolves the lists referenced in rules with @NAME when they
+// are not part of the evaluation bindings
+type ListProvider interface {
+	List(name string) ([]string, error)
+}
+
+// ContextListProvider is implemented by the list providers able to give up
+// fetching a list when the context of the evaluation is done
+type ContextListProvider interface {
+	ListContext(ctx context.Context, name string) ([]string, error)
+}
+
+// fetchList fetches the list from provider, passing ctx along when the
+// provider supports it
+func fetchList(ctx context.Context, provider ListProvider, name string) ([]string, error) {
+	if p, ok := provider.(ContextListProvider); ok {
+		return p.ListContext(ctx, name)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return provider.List(name)
+}
+
+// MemoryListProvider serves lists kept in memory
+type MemoryListProvider struct {
+	mtx   *sync.RWMutex
+	lists map[string][]string
+}
+
+func NewMemoryListProvider(lists map[string][]string) *MemoryListProvider {
+	p := &MemoryListProvider{mtx: &sync.RWMutex{}, lists: make(map[string][]string)}
+	for name, values := range lists {
+		p.Set(name, values)
+	}
+
+	return p
+}
+
+// Set adds or replaces a list
+func (p *MemoryListProvider) Set(name string, values []string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.lists[name] = append([]string{}, values...)
+}
+
+func (p *MemoryListProvider) List(name string) ([]string, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	values, ok := p.lists[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrListNotFound)
+	}
+
+	return values, nil
+}
+
+// FileListProvider reads lists from newline delimited files named after the
+// list in a directory. Blank lines and lines starting with # are ignored
+type FileListProvider struct {
+	dir string
+
+	// Ext is appended to the list name to build the file name
+	Ext string
+}
+
+func NewFileListProvider(dir string) *FileListProvider {
+	return &FileListProvider{dir: dir, Ext: ".txt"}
+}
+
+func (p *FileListProvider) List(name string) ([]string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid list name: %q", name)
+	}
+
+	f, err := os.Open(filepath.Join(p.dir, name+p.Ext))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", name, ErrListNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, line)
+	}
+
+	return values, scanner.Err()
+}
+
+type cachedList struct {
+	values  []string
+	expires time.Time
+}
+
+type listKey struct {
+	name string
+	kind ListKind
+}
+
+type cachedObject struct {
+	list    Object
+	expires time.Time
+}
+
+// CachingListProvider caches the lists of another provider for a TTL, along
+// with the list objects built from them so the patterns of a regex list are
+// only compiled once per TTL. Errors are not cached
+type CachingListProvider struct {
+	provider ListProvider
+	ttl      time.Duration
+
+	mtx     *sync.Mutex
+	entries map[string]cachedList
+	objects map[listKey]cachedObject
+
+	// Now returns the current time, it can be replaced in tests
+	Now func() time.Time
+}
+
+func NewCachingListProvider(provider ListProvider, ttl time.Duration) *CachingListProvider {
+	return &CachingListProvider{
+		provider: provider,
+		ttl:      ttl,
+		mtx:      &sync.Mutex{},
+		entries:  make(map[string]cachedList),
+		objects:  make(map[listKey]cachedObject),
+		Now:      time.Now,
+	}
+}
+
+func (p *CachingListProvider) List(name string) ([]string, error) {
+	return p.ListContext(context.Background(), name)
+}
+
+// ListContext serves the list from the cache or fetches it with ctx
+func (p *CachingListProvider) ListContext(ctx context.Context, name string) ([]string, error) {
+	entry, err := p.list(ctx, name)
+	return entry.values, err
+}
+
+// ListKind RETURNS the kind of the list given by the cached provider
+func (p *CachingListProvider) ListKind(name string) ListKind {
+	if kinds, ok := p.provider.(ListKinds); ok {
+		return kinds.ListKind(name)
+	}
+
+	return ""
+}
+
+func (p *CachingListProvider) list(ctx context.Context, name string) (cachedList, error) {
+	now := p.Now()
+
+	p.mtx.Lock()
+	entry, ok := p.entries[name]
+	p.mtx.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry, nil
+	}
+
+	values, err := fetchList(ctx, p.provider, name)
+	if err != nil {
+		return cachedList{}, err
+	}
+
+	entry = cachedList{values: values, expires: now.Add(p.ttl)}
+	p.mtx.Lock()
+	p.entries[name] = entry
+	p.mtx.Unlock()
+
+	return entry, nil
+}
+
+// buildList serves the list object from the cache or builds it from the
+// values of the list, both expire together
+func (p *CachingListProvider) buildList(ctx context.Context, name string, kind ListKind) (Object, error) {
+	key := listKey{name: name, kind: kind}
+
+	p.mtx.Lock()
+	cached, ok := p.objects[key]
+	p.mtx.Unlock()
+
+	if ok && p.Now().Before(cached.expires) {
+		return cached.list, nil
+	}
+
+	entry, err := p.list(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := buildList(name, kind, entry.values)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	p.objects[key] = cachedObject{list: list, expires: entry.expires}
+	p.mtx.Unlock()
+
+	return list, nil
+}
+
+// Invalidate drops a list from the cache
+func (p *CachingListProvider) Invalidate(name string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	delete(p.entries, name)
+	for key := range p.objects {
+		if key.name == name {
+			delete(p.objects, key)
+		}
+	}
+}
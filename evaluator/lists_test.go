@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingProvider struct {
+	ListProvider
+	calls map[string]int
+}
+
+func (p *countingProvider) List(name string) ([]string, error) {
+	p.calls[name]++
+	return p.ListProvider.List(name)
+}
+
+func TestEvalWithLists(t *testing.T) {
+	p := &countingProvider{
+		ListProvider: NewMemoryListProvider(map[string][]string{
+			"BLOCKED": {`@spam\.com$`},
+			"VIP":     {"alice@example.com"},
+			"UNUSED":  {"x"},
+		}),
+		calls: make(map[string]int),
+	}
+
+	r, err := NewRule(`email contains @BLOCKED OR email in @VIP OR email contains @BLOCKED`, map[string]interface{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"BLOCKED", "VIP"}, r.Lists())
+
+	res, err := r.EvalWithLists(map[string]interface{}{"email": "bob@spam.com"}, p)
+	assert.NoError(t, err)
+	assert.True(t, res)
+	assert.Equal(t, map[string]int{"BLOCKED": 1, "VIP": 1}, p.calls)
+
+	// bindings take precedence over the provider
+	res, err = r.EvalWithLists(map[string]interface{}{"email": "bob@spam.com", "BLOCKED": []string{"nope"}}, p)
+	assert.NoError(t, err)
+	assert.False(t, res)
+	assert.Equal(t, map[string]int{"BLOCKED": 1, "VIP": 2}, p.calls)
+
+	r, err = NewRule(`email contains @MISSING`, map[string]interface{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = r.EvalWithLists(map[string]interface{}{"email": "bob@spam.com"}, p)
+	assert.True(t, errors.Is(err, ErrListNotFound))
+}
+
+func TestFileListProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SKUS.txt"), []byte("# skus\nA-1\n\n  B+2  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewFileListProvider(dir)
+	values, err := p.List("SKUS")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A-1", "B+2"}, values)
+
+	_, err = p.List("OTHER")
+	assert.True(t, errors.Is(err, ErrListNotFound))
+
+	_, err = p.List("../SKUS")
+	assert.Error(t, err)
+}
+
+func TestCachingListProvider(t *testing.T) {
+	mem := NewMemoryListProvider(map[string][]string{"L": {"a"}})
+	counting := &countingProvider{ListProvider: mem, calls: make(map[string]int)}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewCachingListProvider(counting, time.Minute)
+	p.Now = func() time.Time { return now }
+
+	values, _ := p.List("L")
+	assert.Equal(t, []string{"a"}, values)
+
+	mem.Set("L", []string{"b"})
+	now = now.Add(30 * time.Second)
+	values, _ = p.List("L")
+	assert.Equal(t, []string{"a"}, values)
+
+	now = now.Add(time.Minute)
+	values, _ = p.List("L")
+	assert.Equal(t, []string{"b"}, values)
+	assert.Equal(t, 2, counting.calls["L"])
+
+	p.Invalidate("L")
+	p.List("L")
+	assert.Equal(t, 3, counting.calls["L"])
+
+	_, err := p.List("MISSING")
+	assert.True(t, errors.Is(err, ErrListNotFound))
+}
+
+func TestCachingListProviderObjects(t *testing.T) {
+	mem := NewMemoryListProvider(map[string][]string{"RE": {"^a", "b$"}, "SKUS": {"A.1"}})
+	counting := &countingProvider{ListProvider: mem, calls: make(map[string]int)}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewCachingListProvider(WithListKinds(counting, map[string]ListKind{"SKUS": ExactKind}), time.Minute)
+	p.Now = func() time.Time { return now }
+
+	getList := func(name string) Object {
+		env := NewEnvironment(nil)
+		env.SetListProvider(p)
+		list, err := env.GetList(name)
+		assert.NoError(t, err)
+		return list
+	}
+
+	// the list is built once and shared by the evaluations
+	first := getList("RE")
+	assert.Same(t, first, getList("RE"))
+	assert.Equal(t, 1, counting.calls["RE"])
+
+	_, ok := getList("SKUS").(*StringList)
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	assert.NotSame(t, first, getList("RE"))
+	assert.Equal(t, 2, counting.calls["RE"])
+
+	p.Invalidate("RE")
+	getList("RE")
+	assert.Equal(t, 3, counting.calls["RE"])
+}
+
+func BenchmarkCachedRegexList(b *testing.B) {
+	patterns := make([]string, 10000)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf(`^user%d@example\.com$`, i)
+	}
+	p := NewCachingListProvider(NewMemoryListProvider(map[string][]string{"USERS": patterns}), time.Minute)
+
+	r, err := NewRule(`email contains @USERS`, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	params := map[string]interface{}{"email": "user9999@example.com"}
+
+	// the list is built by the first evaluation
+	if _, err := r.EvalWithLists(params, p); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.EvalWithLists(params, p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package evaluator
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// ListMatch describes the list entry or pattern that made a CONTAINS,
+// ANY_MATCH or IN operator true
+type ListMatch struct {
+	List  string // name of the list, empty for inline lists and regexes
+	Value string // value tested against the list
+	Entry string // matching entry or pattern
+	// capture groups of a matching pattern, the whole match first
+	Groups []string
+	Named  map[string]string
+}
+
+// Result is the outcome of a rule evaluation
+type Result struct {
+	Value   bool
+	Matches []ListMatch
+	// rule metadata with the ${match.*} placeholders expanded
+	Metadata map[string]interface{}
+}
+
+func (e *evaluation) recordMatch(node *parser.InfixExpression, left, right Object, result Object) {
+	if !toBool(result) {
+		return
+	}
+
+	switch strings.ToLower(node.Operator) {
+	case "contains", "any_match", "in":
+	default:
+		return
+	}
+
+	m, ok := listMatch(strings.ToLower(node.Operator), left, right)
+	if !ok {
+		return
+	}
+
+	for _, n := range []parser.Expression{node.Right, node.Left} {
+		if l, ok := n.(*parser.ListName); ok {
+			m.List = l.Value
+			break
+		}
+	}
+
+	e.matches = append(e.matches, m)
+	if e.trace != nil {
+		e.trace.Match = &m
+	}
+}
+
+// listMatch RETURNS the entry matching the value of a list operator
+func listMatch(operator string, left, right Object) (ListMatch, bool) {
+	value, list := left, right
+	if isScalar(right) {
+		value, list = right, left
+	}
+
+	if !isScalar(value) {
+		return ListMatch{}, false
+	}
+
+	m := ListMatch{Value: listEntry(value)}
+
+	switch l := list.(type) {
+	case *Regex:
+		re, err := regexp.Compile(l.Value)
+		if err != nil {
+			return ListMatch{}, false
+		}
+		m.Entry = l.Value
+		m.Groups, m.Named = submatches(re, m.Value)
+
+	case *RegexList:
+		if operator == "in" || list == left {
+			if !l.Has(m.Value) {
+				return ListMatch{}, false
+			}
+			m.Entry = m.Value
+			break
+		}
+
+		i, ok := l.MatchIndex(m.Value)
+		if !ok {
+			return ListMatch{}, false
+		}
+		m.Entry = l.Value[i].String()
+		m.Groups, m.Named = submatches(l.Value[i], m.Value)
+
+	case List:
+		entry, ok := l.Match(value)
+		if !ok {
+			return ListMatch{}, false
+		}
+		m.Entry = entry
+
+	default:
+		return ListMatch{}, false
+	}
+
+	return m, true
+}
+
+func submatches(re *regexp.Regexp, s string) ([]string, map[string]string) {
+	groups := re.FindStringSubmatch(s)
+	if groups == nil {
+		return nil, nil
+	}
+
+	var named map[string]string
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if named == nil {
+			named = make(map[string]string)
+		}
+		named[name] = groups[i]
+	}
+
+	return groups, named
+}
+
+var matchPlaceholder = regexp.MustCompile(`\$\{match\.([A-Za-z0-9_.]+)\}`)
+
+// expandMatch replaces the placeholders referencing the first match in s:
+// ${match.list}, ${match.value}, ${match.entry}, ${match.group.N} and
+// ${match.group.NAME}. Unknown placeholders expand to an empty string
+func expandMatch(s string, matches []ListMatch) string {
+	if len(matches) == 0 || !strings.Contains(s, "${match.") {
+		return s
+	}
+
+	m := matches[0]
+	return matchPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		path := matchPlaceholder.FindStringSubmatch(placeholder)[1]
+
+		switch {
+		case path == "list":
+			return m.List
+		case path == "value":
+			return m.Value
+		case path == "entry":
+			return m.Entry
+		case strings.HasPrefix(path, "group."):
+			g := strings.TrimPrefix(path, "group.")
+			if i, err := strconv.Atoi(g); err == nil {
+				if i < len(m.Groups) {
+					return m.Groups[i]
+				}
+				return ""
+			}
+			return m.Named[g]
+		default:
+			return ""
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalResultMatches(t *testing.T) {
+	cidrs, _ := NewCIDRList([]string{"10.0.0.0/8"})
+	params := map[string]interface{}{
+		"email":     "bob@spam.com",
+		"ip":        "10.1.2.3",
+		"country":   "DE",
+		"BLOCKLIST": []string{`^admin@`, `@(?P<domain>spam|junk)\.com$`},
+		"NETS":      cidrs,
+		"COUNTRIES": NewStringList([]string{"AT", "DE"}),
+	}
+
+	testcases := []struct {
+		expr    string
+		value   bool
+		matches []ListMatch
+	}{
+		{
+			`email contains @BLOCKLIST`,
+			true,
+			[]ListMatch{{List: "BLOCKLIST", Value: "bob@spam.com", Entry: `@(?P<domain>spam|junk)\.com$`, Groups: []string{"@spam.com", "spam"}, Named: map[string]string{"domain": "spam"}}},
+		},
+		{
+			`email contains r"^(\w+)@" AND ip in @NETS`,
+			true,
+			[]ListMatch{
+				{Value: "bob@spam.com", Entry: `^(\w+)@`, Groups: []string{"bob@", "bob"}},
+				{List: "NETS", Value: "10.1.2.3", Entry: "10.0.0.0/8"},
+			},
+		},
+		{
+			`@COUNTRIES contains country`,
+			true,
+			[]ListMatch{{List: "COUNTRIES", Value: "DE", Entry: "DE"}},
+		},
+		{
+			`email not_contains @BLOCKLIST`,
+			false,
+			nil,
+		},
+	}
+
+	for i, tt := range testcases {
+		r, err := NewRule(tt.expr, map[string]interface{}{})
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		res := r.EvalResult(params)
+		assert.Equal(t, tt.value, res.Value, fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.matches, res.Matches, fmt.Sprintf("tests[%d]", i))
+	}
+}
+
+func TestMatchInMetadataAndExplain(t *testing.T) {
+	r, err := NewRule(`email contains @BLOCKLIST`, map[string]interface{}{
+		"reason":   "blocked by ${match.entry} from @${match.list} (${match.group.domain}, ${match.group.1})",
+		"severity": 3,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	params := map[string]interface{}{
+		"email":     "bob@junk.com",
+		"BLOCKLIST": []string{`@(?P<domain>spam|junk)\.com$`},
+	}
+
+	res := r.EvalResult(params)
+	assert.Equal(t, `blocked by @(?P<domain>spam|junk)\.com$ from @BLOCKLIST (junk, junk)`, res.Metadata["reason"])
+	assert.Equal(t, 3, res.Metadata["severity"])
+
+	_, trace := r.Explain(params)
+	assert.Equal(t, `(email contains BLOCKLIST) => true [@BLOCKLIST: @(?P<domain>spam|junk)\.com$]`, firstLine(trace.String()))
+
+	// without a match the placeholders are left alone
+	res = r.EvalResult(map[string]interface{}{"email": "bob@example.com", "BLOCKLIST": []string{`zzz`}})
+	assert.Equal(t, "blocked by ${match.entry} from @${match.list} (${match.group.domain}, ${match.group.1})", res.Metadata["reason"])
+}
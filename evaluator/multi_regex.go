@@ -0,0 +1,313 @@
+package evaluator
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+)
+
+const (
+	// patterns combined into one alternation
+	maxChunkPatterns = 256
+	// source length of one alternation
+	maxChunkSource = 32 * 1024
+)
+
+// multiMatcher matches a string against many patterns without scanning it
+// once per pattern. Every pattern requiring a literal substring is only
+// tried when an Aho-Corasick automaton built over those literals finds it
+// in the input. The remaining patterns are combined into alternations
+type multiMatcher struct {
+	patterns []*regexp.Regexp
+	literals *ahoCorasick
+	// patterns requiring each literal of the automaton
+	candidates [][]int
+	chunks     []regexChunk
+}
+
+// regexChunk is an alternation of patterns, each pattern is wrapped in a
+// capture group to find which one matched
+type regexChunk struct {
+	re      *regexp.Regexp
+	indexes []int // index of every pattern of the chunk in the list
+	groups  []int // capture group of every pattern of the chunk
+}
+
+func newMultiMatcher(patterns []*regexp.Regexp) *multiMatcher {
+	m := &multiMatcher{patterns: patterns}
+
+	byLiteral := make(map[string][]int)
+	literals := make([]string, 0)
+	rest := make([]int, 0)
+	for i, re := range patterns {
+		lit := requiredLiteral(re)
+		if lit == "" {
+			rest = append(rest, i)
+			continue
+		}
+
+		if _, ok := byLiteral[lit]; !ok {
+			literals = append(literals, lit)
+		}
+		byLiteral[lit] = append(byLiteral[lit], i)
+	}
+
+	m.literals = newAhoCorasick(literals)
+	for _, lit := range literals {
+		m.candidates = append(m.candidates, byLiteral[lit])
+	}
+
+	start, size := 0, 0
+	for i, idx := range rest {
+		if i > start && (i-start == maxChunkPatterns || size+len(patterns[idx].String()) > maxChunkSource) {
+			m.addChunk(rest[start:i])
+			start, size = i, 0
+		}
+		size += len(patterns[idx].String()) + 3
+	}
+
+	if start < len(rest) {
+		m.addChunk(rest[start:])
+	}
+
+	return m
+}
+
+// addChunk compiles the patterns as one alternation, halving the chunk when
+// the combined pattern is too large to compile
+func (m *multiMatcher) addChunk(indexes []int) {
+	var src strings.Builder
+	groups := make([]int, 0, len(indexes))
+
+	group := 1
+	for i, idx := range indexes {
+		if i > 0 {
+			src.WriteString("|")
+		}
+		src.WriteString("(")
+		src.WriteString(m.patterns[idx].String())
+		src.WriteString(")")
+
+		groups = append(groups, group)
+		group += 1 + m.patterns[idx].NumSubexp()
+	}
+
+	re, err := regexp.Compile(src.String())
+	if err != nil {
+		if len(indexes) == 1 {
+			m.chunks = append(m.chunks, regexChunk{re: m.patterns[indexes[0]], indexes: indexes, groups: []int{0}})
+			return
+		}
+
+		m.addChunk(indexes[:len(indexes)/2])
+		m.addChunk(indexes[len(indexes)/2:])
+		return
+	}
+
+	m.chunks = append(m.chunks, regexChunk{re: re, indexes: indexes, groups: groups})
+}
+
+// match RETURNS the lowest index of the patterns found in s
+func (m *multiMatcher) match(s string) (int, bool) {
+	best := -1
+
+	tried := make(map[int]bool)
+	m.literals.scan(s, func(lit int) {
+		for _, idx := range m.candidates[lit] {
+			if tried[idx] || (best >= 0 && idx > best) {
+				continue
+			}
+
+			tried[idx] = true
+			if m.patterns[idx].MatchString(s) {
+				best = idx
+			}
+		}
+	})
+
+	for _, c := range m.chunks {
+		if best >= 0 && c.indexes[0] > best {
+			break
+		}
+
+		if !c.re.MatchString(s) {
+			continue
+		}
+
+		// only the matching chunks pay for the submatch extraction. The
+		// alternation reports the leftmost match, the patterns of the chunk
+		// listed before it may match further in s
+		loc := c.re.FindStringSubmatchIndex(s)
+		found := len(c.groups)
+		for i, g := range c.groups {
+			if loc[2*g] >= 0 {
+				found = i
+				break
+			}
+		}
+
+		for i := 0; i < found; i++ {
+			if m.patterns[c.indexes[i]].MatchString(s) {
+				found = i
+				break
+			}
+		}
+
+		if found < len(c.indexes) && (best < 0 || c.indexes[found] < best) {
+			best = c.indexes[found]
+		}
+	}
+
+	return best, best >= 0
+}
+
+// requiredLiteral RETURNS the longest case sensitive literal every match
+// of re contains, or "" when there is none
+func requiredLiteral(re *regexp.Regexp) string {
+	prog, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+
+	return literalOf(prog.Simplify())
+}
+
+func literalOf(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+
+	case syntax.OpCapture, syntax.OpPlus:
+		return literalOf(re.Sub[0])
+
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return ""
+		}
+		return literalOf(re.Sub[0])
+
+	case syntax.OpConcat:
+		// adjacent literals form a longer literal, other nodes split them
+		longest, current := "", ""
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0 {
+				current += string(sub.Rune)
+			} else {
+				if len(current) > len(longest) {
+					longest = current
+				}
+				current = ""
+
+				if lit := literalOf(sub); len(lit) > len(longest) {
+					longest = lit
+				}
+			}
+		}
+
+		if len(current) > len(longest) {
+			longest = current
+		}
+		return longest
+
+	default:
+		return ""
+	}
+}
+
+// ahoCorasick finds every occurrence of a set of literals in one pass
+type ahoCorasick struct {
+	next    []map[byte]int
+	fail    []int
+	outputs [][]int
+}
+
+func newAhoCorasick(literals []string) *ahoCorasick {
+	a := &ahoCorasick{
+		next:    []map[byte]int{{}},
+		fail:    []int{0},
+		outputs: [][]int{nil},
+	}
+
+	for i, lit := range literals {
+		state := 0
+		for j := 0; j < len(lit); j++ {
+			n, ok := a.next[state][lit[j]]
+			if !ok {
+				n = len(a.next)
+				a.next = append(a.next, map[byte]int{})
+				a.fail = append(a.fail, 0)
+				a.outputs = append(a.outputs, nil)
+				a.next[state][lit[j]] = n
+			}
+			state = n
+		}
+		a.outputs[state] = append(a.outputs[state], i)
+	}
+
+	// breadth first so the failure state of the parent is always known
+	queue := make([]int, 0, len(a.next))
+	for _, c := range sortedEdges(a.next[0]) {
+		queue = append(queue, a.next[0][c])
+	}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, c := range sortedEdges(a.next[state]) {
+			child := a.next[state][c]
+			queue = append(queue, child)
+
+			f := a.fail[state]
+			for {
+				if n, ok := a.next[f][c]; ok && n != child {
+					a.fail[child] = n
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = a.fail[f]
+			}
+
+			a.outputs[child] = append(a.outputs[child], a.outputs[a.fail[child]]...)
+		}
+	}
+
+	return a
+}
+
+// scan calls found with the index of every literal occurring in s
+func (a *ahoCorasick) scan(s string, found func(lit int)) {
+	state := 0
+	for i := 0; i < len(s); i++ {
+		for {
+			if n, ok := a.next[state][s[i]]; ok {
+				state = n
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = a.fail[state]
+		}
+
+		for _, lit := range a.outputs[state] {
+			found(lit)
+		}
+	}
+}
+
+func sortedEdges(edges map[byte]int) []byte {
+	keys := make([]byte, 0, len(edges))
+	for c := range edges {
+		keys = append(keys, c)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
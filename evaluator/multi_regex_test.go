@@ -0,0 +1,145 @@
+package evaluator
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiMatcher(t *testing.T) {
+	patterns := []string{`^admin@`, `(spam|junk)\.com$`, `(?i)casino`, `x(?P<n>\d+)y`, `@evil\.org$`}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		compiled = append(compiled, regexp.MustCompile(p))
+	}
+
+	testcases := []struct {
+		input   string
+		index   int
+		matched bool
+	}{
+		{"admin@example.com", 0, true},
+		{"bob@junk.com", 1, true},
+		{"play CASINO now", 2, true},
+		{"x42y", 3, true},
+		{"eve@evil.org", 4, true},
+		{"bob@example.com", -1, false},
+	}
+
+	m := newMultiMatcher(compiled)
+	assert.Equal(t, 1, len(m.chunks))
+	for i, tt := range testcases {
+		index, ok := m.match(tt.input)
+		assert.Equal(t, tt.matched, ok, fmt.Sprintf("tests[%d]", i))
+		assert.Equal(t, tt.index, index, fmt.Sprintf("tests[%d]", i))
+	}
+
+	// without literals every pattern goes through the alternations, small
+	// chunks exercise the chunk boundaries
+	for _, size := range []int{1, 2, len(patterns)} {
+		m := &multiMatcher{patterns: compiled, literals: newAhoCorasick(nil)}
+		for from := 0; from < len(compiled); from += size {
+			to := from + size
+			if to > len(compiled) {
+				to = len(compiled)
+			}
+
+			indexes := make([]int, 0, size)
+			for i := from; i < to; i++ {
+				indexes = append(indexes, i)
+			}
+			m.addChunk(indexes)
+		}
+
+		for i, tt := range testcases {
+			index, ok := m.match(tt.input)
+			assert.Equal(t, tt.matched, ok, fmt.Sprintf("chunk %d tests[%d]", size, i))
+			assert.Equal(t, tt.index, index, fmt.Sprintf("chunk %d tests[%d]", size, i))
+		}
+	}
+
+	l := NewRegexList(patterns)
+	entry, ok := l.Match(&String{Value: "eve@evil.org"})
+	assert.True(t, ok)
+	assert.Equal(t, `@evil\.org$`, entry)
+}
+
+func TestMultiMatcherLowestIndex(t *testing.T) {
+	// the alternation finds "a" first, the lower indexed pattern matches "b"
+	m := newMultiMatcher([]*regexp.Regexp{regexp.MustCompile(`[bc]`), regexp.MustCompile(`[ad]`)})
+	assert.Equal(t, 1, len(m.chunks))
+
+	index, ok := m.match("ab")
+	assert.True(t, ok)
+	assert.Equal(t, 0, index)
+
+	index, ok = m.match("da")
+	assert.True(t, ok)
+	assert.Equal(t, 1, index)
+}
+
+func TestRequiredLiteral(t *testing.T) {
+	testcases := []struct {
+		pattern  string
+		expected string
+	}{
+		{`^admin@example\.com$`, "admin@example.com"},
+		{`(spam|junk)\.com$`, ".com"},
+		{`(?i)casino`, ""},
+		{`a+bcd*`, "bc"},
+		{`(?:xyz)+q`, "xyz"},
+		{`x?`, ""},
+	}
+
+	for _, tt := range testcases {
+		assert.Equal(t, tt.expected, requiredLiteral(regexp.MustCompile(tt.pattern)), tt.pattern)
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	a := newAhoCorasick([]string{"he", "she", "his", "hers"})
+
+	found := make([]int, 0)
+	a.scan("ushers", func(lit int) { found = append(found, lit) })
+	assert.Equal(t, []int{1, 0, 3}, found)
+}
+
+func benchmarkPatterns(n int) (*RegexList, string) {
+	patterns := make([]string, n)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf(`^user%d@domain%d\.com$`, i, i%97)
+	}
+
+	return NewRegexList(patterns), "nobody@example.com"
+}
+
+func benchmarkNaive(b *testing.B, n int) {
+	l, input := benchmarkPatterns(n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, re := range l.Value {
+			if re.MatchString(input) {
+				break
+			}
+		}
+	}
+}
+
+func benchmarkCombined(b *testing.B, n int) {
+	l, input := benchmarkPatterns(n)
+	l.MatchIndex("")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.MatchIndex(input)
+	}
+}
+
+func BenchmarkRegexListNaive1k(b *testing.B)      { benchmarkNaive(b, 1000) }
+func BenchmarkRegexListCombined1k(b *testing.B)   { benchmarkCombined(b, 1000) }
+func BenchmarkRegexListNaive10k(b *testing.B)     { benchmarkNaive(b, 10000) }
+func BenchmarkRegexListCombined10k(b *testing.B)  { benchmarkCombined(b, 10000) }
+func BenchmarkRegexListNaive100k(b *testing.B)    { benchmarkNaive(b, 100000) }
+func BenchmarkRegexListCombined100k(b *testing.B) { benchmarkCombined(b, 100000) }
@@ -3,6 +3,7 @@ package evaluator
 import (
 	"fmt"
 	"regexp"
+	"sync"
 )
 
 type ObjectType string
@@ -72,6 +73,9 @@ func (b *Regex) Inspect() string {
 
 type RegexList struct {
 	Value []*regexp.Regexp
+
+	once    sync.Once
+	matcher *multiMatcher
 }
 
 func (b *RegexList) Type() ObjectType {
@@ -82,6 +86,41 @@ func (b *RegexList) Inspect() string {
 	return fmt.Sprintf("%q", b.Value)
 }
 
+func (b *RegexList) Len() int {
+	return len(b.Value)
+}
+
+// Match RETURNS a pattern found in value
+func (b *RegexList) Match(value Object) (string, bool) {
+	i, ok := b.MatchIndex(listEntry(value))
+	if !ok {
+		return "", false
+	}
+
+	return b.Value[i].String(), true
+}
+
+// MatchIndex RETURNS the index of a pattern found in s. The patterns are
+// combined into a few alternations the first time the list is matched
+func (b *RegexList) MatchIndex(s string) (int, bool) {
+	b.once.Do(func() {
+		b.matcher = newMultiMatcher(b.Value)
+	})
+
+	return b.matcher.match(s)
+}
+
+// Has reports whether value is one of the list entries, compared literally
+func (b *RegexList) Has(value string) bool {
+	for _, re := range b.Value {
+		if re.String() == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 func NewRegexList(values []string) *RegexList {
 	rs := make([]*regexp.Regexp, 0)
 
@@ -99,16 +138,8 @@ func NewRegexList(values []string) *RegexList {
 
 type Error struct {
 	Message string
+	Code    ErrorCode // set when a limit is broken
 }
 
 func (e *Error) Type() ObjectType { return ErrorObject }
 func (e *Error) Inspect() string  { return "error: " + e.Message }
-
-func toObject(val interface{}) Object {
-	switch val := val.(type) {
-	case *RegexList:
-		return val
-	default:
-		return nil
-	}
-}
@@ -1,35 +1,67 @@
 package evaluator
 
 import (
-	"errors"
-	"strings"
+	"context"
 
 	"github.com/zain-bahsarat/rule_egine/parser"
 )
 
+// Rule is a compiled expression. Rules are immutable and can be evaluated
+// from many goroutines at once
 type Rule struct {
 	expression string
 	parsedRule *parser.Rule
 	metadata   map[string]interface{}
+	lists      []string
+	limits     Limits
+	engine     *Engine
 }
 
+// NewRule parses the expression within DefaultLimits, the rule can call
+// the builtin functions
 func NewRule(expression string, metadata map[string]interface{}) (*Rule, error) {
+	return NewRuleWithLimits(expression, metadata, DefaultLimits)
+}
+
+// NewRuleWithLimits parses the expression, the limits apply to the parsing
+// and to every evaluation of the rule. Breaking a limit RETURNS a *RuleError
+func NewRuleWithLimits(expression string, metadata map[string]interface{}, limits Limits) (*Rule, error) {
+	return defaultEngine.compile(expression, metadata, limits, nil)
+}
 
-	p := parser.New(parser.NewLexer(expression))
-	parsedRule := p.ParseRule()
-	if len(p.Errors()) > 0 {
-		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+// referencedLists RETURNS the names of the lists used by the parsed rule
+func referencedLists(rule *parser.Rule) []string {
+	seen := make(map[string]bool)
+	lists := make([]string, 0)
+
+	var walk func(node parser.Node)
+	walk = func(node parser.Node) {
+		switch node := node.(type) {
+		case *parser.ListName:
+			if !seen[node.Value] {
+				seen[node.Value] = true
+				lists = append(lists, node.Value)
+			}
+		case *parser.ExpressionStatement:
+			walk(node.Expression)
+		case *parser.PrefixExpression:
+			walk(node.Right)
+		case *parser.InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *parser.CallExpression:
+			for _, arg := range node.Arguments {
+				walk(arg)
+			}
+		}
 	}
+	walk(rule.Statement)
 
-	return &Rule{
-		expression: expression,
-		parsedRule: parsedRule,
-		metadata:   metadata,
-	}, nil
+	return lists
 }
 
 func (r *Rule) Eval(params map[string]interface{}) bool {
-	result := Eval(r.parsedRule, NewEnvironment(params))
+	result := r.newEvaluation().eval(r.parsedRule, NewEnvironment(params))
 
 	res, ok := result.(*Boolean)
 	if !ok {
@@ -39,14 +71,128 @@ func (r *Rule) Eval(params map[string]interface{}) bool {
 	return res.Value == true
 }
 
+// Evaluate evaluates the rule like Eval and RETURNS a *RuleError when the
+// evaluation fails or breaks a limit
+func (r *Rule) Evaluate(params map[string]interface{}) (bool, error) {
+	return r.EvalContext(context.Background(), params)
+}
+
+// EvalContext is Evaluate stopping when ctx is done. The context is checked
+// between node visits and before calling functions and list providers, a
+// done context RETURNS a *RuleError with the CodeCancelled or CodeTimeout code
+func (r *Rule) EvalContext(ctx context.Context, params map[string]interface{}) (bool, error) {
+	e := r.newEvaluation()
+	e.ctx = ctx
+
+	result := e.eval(r.parsedRule, NewEnvironment(params))
+	if err := toRuleError(result); err != nil {
+		return false, err
+	}
+
+	return toBool(result), nil
+}
+
+func (r *Rule) newEvaluation() *evaluation {
+	return &evaluation{limits: r.limits, functions: r.engine.loadFunctions()}
+}
+
+// EvalWithLists evaluates the rule resolving the lists missing from params
+// with lists. The lists the rule references are fetched before evaluating
+func (r *Rule) EvalWithLists(params map[string]interface{}, lists ListProvider) (bool, error) {
+	return r.EvalWithListsContext(context.Background(), params, lists)
+}
+
+// EvalWithListsContext is EvalWithLists stopping when ctx is done, the
+// context is passed to the providers implementing ContextListProvider
+func (r *Rule) EvalWithListsContext(ctx context.Context, params map[string]interface{}, lists ListProvider) (bool, error) {
+	env := NewEnvironment(params)
+	env.SetListProvider(lists)
+
+	e := r.newEvaluation()
+	e.ctx = ctx
+	if err := env.PrefetchContext(ctx, r.lists); err != nil {
+		if rerr := e.interrupted(); rerr != nil {
+			return false, toRuleError(rerr)
+		}
+		return false, err
+	}
+
+	result := e.eval(r.parsedRule, env)
+	if err := e.interrupted(); err != nil {
+		return false, toRuleError(err)
+	}
+	if err := toRuleError(result); err != nil {
+		return false, err
+	}
+
+	return toBool(result), nil
+}
+
+// EvalResult evaluates the rule and RETURNS the result with the list
+// entries that matched. String metadata values referencing the first match
+// with ${match.entry}, ${match.value}, ${match.list} or ${match.group.N}
+// are expanded
+func (r *Rule) EvalResult(params map[string]interface{}) *Result {
+	e := r.newEvaluation()
+	e.recordMatches = true
+	res := &Result{Value: toBool(e.eval(r.parsedRule, NewEnvironment(params)))}
+	res.Matches = e.matches
+
+	res.Metadata = make(map[string]interface{}, len(r.metadata))
+	for k, v := range r.metadata {
+		if s, ok := v.(string); ok {
+			v = expandMatch(s, res.Matches)
+		}
+		res.Metadata[k] = v
+	}
+
+	return res
+}
+
+// Lists returns the names of the lists referenced by the rule
+func (r *Rule) Lists() []string {
+	return append([]string{}, r.lists...)
+}
+
 func (r *Rule) Expression() string {
 	return r.expression
 }
 
-func (r *Rule) AddMetadata(key string, value interface{}) {
-	r.metadata[key] = value
+// WithMetadata RETURNS a copy of the rule with the metadata key set to value
+func (r *Rule) WithMetadata(key string, value interface{}) *Rule {
+	c := *r
+	c.metadata = copyMetadata(r.metadata)
+	c.metadata[key] = value
+
+	return &c
 }
 
 func (r *Rule) GetMetadata(key string) interface{} {
 	return r.metadata[key]
 }
+
+func (r *Rule) AST() *parser.Rule {
+	return r.parsedRule
+}
+
+// EvalNode evaluates node, the rule AST or a part of it, with the functions
+// and the limits of the rule
+func (r *Rule) EvalNode(node parser.Node, env *Environment) Object {
+	return r.newEvaluation().eval(node, env)
+}
+
+// Engine returns the engine that compiled the rule
+func (r *Rule) Engine() *Engine {
+	return r.engine
+}
+
+// Limits returns the limits of the rule
+func (r *Rule) Limits() Limits {
+	return r.limits
+}
+
+// Explain evaluates the rule and RETURNS the result along with the trace
+func (r *Rule) Explain(params map[string]interface{}) (bool, *Trace) {
+	result, trace := r.newEvaluation().explain(r.parsedRule, NewEnvironment(params))
+	return toBool(result), trace
+}
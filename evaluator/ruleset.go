@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+)
+
+// RuleSet is an ordered collection of rules evaluated against the same input
+type RuleSet struct {
+	rules []*Rule
+}
+
+func NewRuleSet(rules ...*Rule) *RuleSet {
+	rs := &RuleSet{rules: make([]*Rule, 0, len(rules))}
+	for _, r := range rules {
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+// Add appends the rule to the set
+func (rs *RuleSet) Add(r *Rule) {
+	rs.rules = append(rs.rules, r)
+}
+
+// Rules returns the rules in insertion order
+func (rs *RuleSet) Rules() []*Rule {
+	rules := make([]*Rule, len(rs.rules))
+	copy(rules, rs.rules)
+	return rules
+}
+
+// Len returns the number of rules in the set
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Eval evaluates every rule against params and RETURNS the matching rules in order
+func (rs *RuleSet) Eval(params map[string]interface{}) []*Rule {
+	env := NewEnvironment(params)
+
+	matched := make([]*Rule, 0)
+	for _, r := range rs.rules {
+		res, ok := r.newEvaluation().eval(r.parsedRule, env).(*Boolean)
+		if ok && res.Value {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
+
+// EvalContext evaluates every rule against params like Eval. It RETURNS the
+// matching rules and the error of the first rule failing to evaluate, the
+// remaining rules are still evaluated. The evaluation stops when ctx is done
+func (rs *RuleSet) EvalContext(ctx context.Context, params map[string]interface{}) ([]*Rule, error) {
+	matched, failures, err := rs.EvalFailures(ctx, params)
+	if err != nil {
+		return matched, err
+	}
+	if len(failures) > 0 {
+		return matched, failures[0]
+	}
+
+	return matched, nil
+}
+
+// Failure is a rule of a set that failed to evaluate
+type Failure struct {
+	Rule *Rule
+	Err  error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("rule %q: %s", f.Rule.expression, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// EvalFailures evaluates every rule against params like EvalContext and
+// RETURNS the matching rules along with every rule failing to evaluate.
+// err is only set when ctx is done, the evaluation stops then
+func (rs *RuleSet) EvalFailures(ctx context.Context, params map[string]interface{}) (matched []*Rule, failures []*Failure, err error) {
+	env := NewEnvironment(params)
+
+	matched = make([]*Rule, 0)
+	for _, r := range rs.rules {
+		e := r.newEvaluation()
+		e.ctx = ctx
+
+		result := e.eval(r.parsedRule, env)
+		if err := e.interrupted(); err != nil {
+			return matched, failures, toRuleError(err)
+		}
+
+		if err := toRuleError(result); err != nil {
+			failures = append(failures, &Failure{Rule: r, Err: err})
+			continue
+		}
+
+		if toBool(result) {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched, failures, nil
+}
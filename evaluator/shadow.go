@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Disagreement is reported when the candidate and the primary rule of a
+// shadow evaluation return different results for the same input
+type Disagreement struct {
+	Input     map[string]interface{}
+	Primary   *Rule
+	Candidate *Rule
+
+	PrimaryResult   bool
+	CandidateResult bool
+	PrimaryTrace    *Trace
+	CandidateTrace  *Trace
+
+	// set when the candidate failed to evaluate
+	Err error
+}
+
+// ShadowSink receives the disagreements found by shadow evaluations
+type ShadowSink interface {
+	Report(d Disagreement)
+}
+
+// ShadowSinkFunc adapts a function to the ShadowSink interface
+type ShadowSinkFunc func(d Disagreement)
+
+func (f ShadowSinkFunc) Report(d Disagreement) { f(d) }
+
+// Shadow evaluates a candidate rule alongside the primary one. Only the
+// primary result is returned to the caller, the candidate result is only
+// compared with it
+type Shadow struct {
+	primary   *Rule
+	candidate *Rule
+	sink      ShadowSink
+}
+
+// NewShadow compiles the candidate expression to run in the shadow of primary
+func NewShadow(primary *Rule, candidate string, sink ShadowSink) (*Shadow, error) {
+	if sink == nil {
+		return nil, errors.New("shadow: sink is required")
+	}
+
+	c, err := primary.engine.compile(candidate, primary.metadata, primary.limits, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Shadow{primary: primary, candidate: c, sink: sink}, nil
+}
+
+func (s *Shadow) Primary() *Rule   { return s.primary }
+func (s *Shadow) Candidate() *Rule { return s.candidate }
+
+// Eval evaluates both rules on the same environment and RETURNS the result of
+// the primary rule. Disagreements are reported with the traces of both rules,
+// a candidate failing to evaluate is reported with its error. Each rule is
+// evaluated once, the traces are recorded along
+func (s *Shadow) Eval(params map[string]interface{}) bool {
+	env := NewEnvironment(params)
+	result, primaryTrace := s.primary.newEvaluation().explain(s.primary.parsedRule, env)
+	primary := toBool(result)
+
+	candidate, candidateTrace, err := s.evalCandidate(env)
+	if err == nil && candidate == primary {
+		return primary
+	}
+
+	s.sink.Report(Disagreement{
+		Input:           params,
+		Primary:         s.primary,
+		Candidate:       s.candidate,
+		PrimaryResult:   primary,
+		CandidateResult: candidate,
+		PrimaryTrace:    primaryTrace,
+		CandidateTrace:  candidateTrace,
+		Err:             err,
+	})
+
+	return primary
+}
+
+// evalCandidate keeps a failing candidate from affecting the caller, the
+// trace is only returned when the candidate evaluates
+func (s *Shadow) evalCandidate(env *Environment) (res bool, trace *Trace, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, trace, err = false, nil, fmt.Errorf("candidate panicked: %v", r)
+		}
+	}()
+
+	result, trace := s.candidate.newEvaluation().explain(s.candidate.parsedRule, env)
+	if err := toRuleError(result); err != nil {
+		return false, nil, err
+	}
+
+	return toBool(result), trace, nil
+}
+
+func toBool(obj Object) bool {
+	res, ok := obj.(*Boolean)
+	return ok && res.Value
+}
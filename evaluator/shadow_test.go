@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	r, err := NewRule(`a > 1 AND b == "x"`, map[string]interface{}{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	res, trace := r.Explain(map[string]interface{}{"a": 2, "b": "y"})
+	assert.False(t, res)
+	assert.Equal(t, `((a > 1) AND (b == "x")) => false
+  (a > 1) => true
+    a => 2.000000
+    1 => 1.000000
+  (b == "x") => false
+    b => y
+    "x" => x
+`, trace.String())
+}
+
+func TestShadow(t *testing.T) {
+	primary, err := NewRule(`amount > 100`, map[string]interface{}{"id": "limit"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reports := make([]Disagreement, 0)
+	s, err := NewShadow(primary, `amount > 200`, ShadowSinkFunc(func(d Disagreement) {
+		reports = append(reports, d)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, s.Eval(map[string]interface{}{"amount": 300}))
+	assert.False(t, s.Eval(map[string]interface{}{"amount": 50}))
+	assert.Len(t, reports, 0)
+
+	// the candidate disagrees, the primary result is still returned
+	assert.True(t, s.Eval(map[string]interface{}{"amount": 150}))
+	if assert.Len(t, reports, 1) {
+		d := reports[0]
+		assert.Equal(t, map[string]interface{}{"amount": 150}, d.Input)
+		assert.True(t, d.PrimaryResult)
+		assert.False(t, d.CandidateResult)
+		assert.Equal(t, "(amount > 100) => true", firstLine(d.PrimaryTrace.String()))
+		assert.Equal(t, "(amount > 200) => false", firstLine(d.CandidateTrace.String()))
+		assert.Equal(t, "limit", d.Candidate.GetMetadata("id"))
+	}
+
+	_, err = NewShadow(primary, `amount >`, ShadowSinkFunc(func(d Disagreement) {}))
+	assert.Error(t, err)
+
+	// a candidate that can't be evaluated never affects the caller
+	broken, err := NewShadow(primary, ``, ShadowSinkFunc(func(d Disagreement) {
+		reports = append(reports, d)
+	}))
+	if assert.NoError(t, err) {
+		assert.True(t, broken.Eval(map[string]interface{}{"amount": 150}))
+		assert.Error(t, reports[len(reports)-1].Err)
+	}
+
+	// a candidate returning an error is reported even when the primary
+	// result is false
+	reports = reports[:0]
+	failing, err := NewShadow(primary, `missing > 100`, ShadowSinkFunc(func(d Disagreement) {
+		reports = append(reports, d)
+	}))
+	if assert.NoError(t, err) {
+		assert.False(t, failing.Eval(map[string]interface{}{"amount": 50}))
+		if assert.Len(t, reports, 1) {
+			var re *RuleError
+			assert.True(t, errors.As(reports[0].Err, &re))
+			assert.False(t, reports[0].CandidateResult)
+			assert.Nil(t, reports[0].CandidateTrace)
+		}
+	}
+
+	_, err = NewShadow(primary, `amount > 200`, nil)
+	assert.Error(t, err)
+}
+
+func TestShadowEngineFunctions(t *testing.T) {
+	calls := 0
+	en := NewEngine()
+	assert.NoError(t, en.Register("double", func(args []Object) (Object, error) {
+		calls++
+		return &Number{Value: 2 * args[0].(*Number).Value}, nil
+	}))
+
+	primary, err := en.NewRule(`double(amount) > 100`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reports := make([]Disagreement, 0)
+	s, err := NewShadow(primary, `double(amount) > 200`, ShadowSinkFunc(func(d Disagreement) {
+		reports = append(reports, d)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// each rule is evaluated once, the traces come from the same pass
+	assert.True(t, s.Eval(map[string]interface{}{"amount": 60}))
+	assert.Equal(t, 2, calls)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "(double(amount) > 100) => true", firstLine(reports[0].PrimaryTrace.String()))
+		assert.Equal(t, "(double(amount) > 200) => false", firstLine(reports[0].CandidateTrace.String()))
+	}
+}
+
+func firstLine(s string) string {
+	for i, c := range s {
+		if c == '\n' {
+			return s[:i]
+		}
+	}
+
+	return s
+}
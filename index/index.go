@@ -0,0 +1,298 @@
+package index
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// predicate is an equality or IN test on an input field found in the
+// top-level AND chain of a rule. The rule can only match when the field
+// holds one of the values
+type predicate struct {
+	field string
+	keys  []string
+}
+
+// Index selects the rules worth evaluating for an input using hash indexes
+// built on equality predicates. Rules without such predicates are always
+// returned as candidates
+type Index struct {
+	rules  []*evaluator.Rule
+	fields map[string]map[string][]int // field -> value key -> rules
+	scan   []int                       // rules that can't be indexed
+}
+
+// Stats describes how the rules were indexed
+type Stats struct {
+	Rules     int
+	Indexed   int
+	Unindexed int
+	Fields    []string
+}
+
+// New analyzes the rules of rs and builds the index
+func New(rs *evaluator.RuleSet) *Index {
+	ix := &Index{
+		rules:  rs.Rules(),
+		fields: make(map[string]map[string][]int),
+		scan:   make([]int, 0),
+	}
+
+	preds := make([][]predicate, len(ix.rules))
+	distinct := make(map[string]map[string]bool)
+	for i, r := range ix.rules {
+		preds[i] = predicates(r.AST())
+		for _, p := range preds[i] {
+			if distinct[p.field] == nil {
+				distinct[p.field] = make(map[string]bool)
+			}
+			for _, k := range p.keys {
+				distinct[p.field][k] = true
+			}
+		}
+	}
+
+	for i := range ix.rules {
+		if len(preds[i]) == 0 {
+			ix.scan = append(ix.scan, i)
+			continue
+		}
+
+		// index each rule once, on the field with the most distinct values
+		// as it is the most likely to discriminate
+		best := preds[i][0]
+		for _, p := range preds[i][1:] {
+			if len(distinct[p.field]) > len(distinct[best.field]) {
+				best = p
+			}
+		}
+
+		if ix.fields[best.field] == nil {
+			ix.fields[best.field] = make(map[string][]int)
+		}
+		for _, k := range best.keys {
+			ix.fields[best.field][k] = append(ix.fields[best.field][k], i)
+		}
+	}
+
+	return ix
+}
+
+// Candidates RETURNS the rules that may match params, in rule set order
+func (ix *Index) Candidates(params map[string]interface{}) []*evaluator.Rule {
+	ids := append([]int{}, ix.scan...)
+	for field, values := range ix.fields {
+		k, ok := inputKey(params[field])
+		if !ok {
+			continue
+		}
+		ids = append(ids, values[k]...)
+	}
+
+	sort.Ints(ids)
+
+	candidates := make([]*evaluator.Rule, 0, len(ids))
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		candidates = append(candidates, ix.rules[id])
+	}
+
+	return candidates
+}
+
+// Eval evaluates the candidate rules and RETURNS the matching ones in rule set order
+func (ix *Index) Eval(params map[string]interface{}) []*evaluator.Rule {
+	env := evaluator.NewEnvironment(params)
+
+	matched := make([]*evaluator.Rule, 0)
+	for _, r := range ix.Candidates(params) {
+		res, ok := r.EvalNode(r.AST(), env).(*evaluator.Boolean)
+		if ok && res.Value {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
+
+// EvalContext is Eval reporting the first candidate failing to evaluate as
+// an *evaluator.Failure like evaluator.RuleSet.EvalContext, the remaining
+// candidates are still evaluated. The evaluation stops when ctx is done
+func (ix *Index) EvalContext(ctx context.Context, params map[string]interface{}) ([]*evaluator.Rule, error) {
+	var failure error
+
+	matched := make([]*evaluator.Rule, 0)
+	for _, r := range ix.Candidates(params) {
+		res, err := r.EvalContext(ctx, params)
+		if err != nil && ctx.Err() != nil {
+			return matched, err
+		}
+		if err != nil {
+			if failure == nil {
+				failure = &evaluator.Failure{Rule: r, Err: err}
+			}
+			continue
+		}
+
+		if res {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched, failure
+}
+
+// Stats returns the index statistics
+func (ix *Index) Stats() Stats {
+	st := Stats{
+		Rules:     len(ix.rules),
+		Unindexed: len(ix.scan),
+		Fields:    make([]string, 0, len(ix.fields)),
+	}
+	st.Indexed = st.Rules - st.Unindexed
+
+	for f := range ix.fields {
+		st.Fields = append(st.Fields, f)
+	}
+	sort.Strings(st.Fields)
+
+	return st
+}
+
+// predicates RETURNS the indexable predicates of the top-level AND chain
+func predicates(r *parser.Rule) []predicate {
+	stmt, ok := r.Statement.(*parser.ExpressionStatement)
+	if !ok || stmt.Expression == nil {
+		return nil
+	}
+
+	preds := make([]predicate, 0)
+	for _, cond := range conjuncts(stmt.Expression) {
+		if p, ok := toPredicate(cond); ok {
+			preds = append(preds, p)
+		}
+	}
+
+	return preds
+}
+
+func conjuncts(expr parser.Expression) []parser.Expression {
+	in, ok := expr.(*parser.InfixExpression)
+	if !ok || strings.ToLower(in.Operator) != "and" {
+		return []parser.Expression{expr}
+	}
+
+	return append(conjuncts(in.Left), conjuncts(in.Right)...)
+}
+
+func toPredicate(expr parser.Expression) (predicate, bool) {
+	in, ok := expr.(*parser.InfixExpression)
+	if !ok {
+		return predicate{}, false
+	}
+
+	switch strings.ToLower(in.Operator) {
+	case "==":
+		ident, lit := in.Left, in.Right
+		if _, ok := ident.(*parser.Identifier); !ok {
+			ident, lit = lit, ident
+		}
+
+		id, ok := ident.(*parser.Identifier)
+		if !ok {
+			return predicate{}, false
+		}
+
+		k, ok := literalKey(lit)
+		if !ok {
+			return predicate{}, false
+		}
+
+		return predicate{field: id.Value, keys: []string{k}}, true
+
+	case "in":
+		id, ok := in.Left.(*parser.Identifier)
+		if !ok {
+			return predicate{}, false
+		}
+
+		call, ok := in.Right.(*parser.CallExpression)
+		if !ok || !strings.EqualFold(call.Function.String(), evaluator.ListFN) {
+			return predicate{}, false
+		}
+
+		keys := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			entry, ok := listEntry(arg)
+			if !ok {
+				return predicate{}, false
+			}
+
+			// IN compares the textual entry, so numbers and strings
+			// with the same representation both match
+			keys = append(keys, "s:"+entry)
+			if n, err := strconv.ParseFloat(entry, 64); err == nil && formatNumber(n) == entry {
+				keys = append(keys, "n:"+entry)
+			}
+		}
+
+		return predicate{field: id.Value, keys: keys}, true
+	}
+
+	return predicate{}, false
+}
+
+func literalKey(expr parser.Expression) (string, bool) {
+	switch lit := expr.(type) {
+	case *parser.StringLiteral:
+		return "s:" + lit.Value, true
+	case *parser.NumberLiteral:
+		return "n:" + formatNumber(lit.Value), true
+	case *parser.BooleanLiteral:
+		return "b:" + strconv.FormatBool(lit.Value), true
+	default:
+		return "", false
+	}
+}
+
+// listEntry mirrors the entries built by the list function, numbers are
+// formatted from their value ("1.0" is "1")
+func listEntry(expr parser.Expression) (string, bool) {
+	switch lit := expr.(type) {
+	case *parser.StringLiteral:
+		return lit.TokenLiteral(), true
+	case *parser.NumberLiteral:
+		return formatNumber(lit.Value), true
+	default:
+		return "", false
+	}
+}
+
+// inputKey mirrors the conversion done when building the evaluation environment
+func inputKey(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return "s:" + v, true
+	case bool:
+		return "b:" + strconv.FormatBool(v), true
+	case float64:
+		return "n:" + formatNumber(v), true
+	case int64:
+		return "n:" + formatNumber(float64(v)), true
+	case int:
+		return "n:" + formatNumber(float64(v)), true
+	default:
+		return "", false
+	}
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
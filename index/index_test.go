@@ -0,0 +1,138 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+func newRuleSet(t testing.TB, expressions ...string) *evaluator.RuleSet {
+	rs := evaluator.NewRuleSet()
+	for _, expr := range expressions {
+		r, err := evaluator.NewRule(expr, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("could not compile %q: %s", expr, err)
+		}
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+func expressions(rules []*evaluator.Rule) []string {
+	exprs := make([]string, 0, len(rules))
+	for _, r := range rules {
+		exprs = append(exprs, r.Expression())
+	}
+
+	return exprs
+}
+
+func TestIndexCandidates(t *testing.T) {
+	rs := newRuleSet(t,
+		`tenant == "a" AND product == "x" AND amount > 10`,
+		`tenant == "a" AND product == "y"`,
+		`tenant == "b" AND product IN list("x", "y", "z")`,
+		`"b" == tenant AND code IN list(1, 2)`,
+		`amount > 100`,
+		`tenant == "a" OR tenant == "b"`,
+	)
+	ix := New(rs)
+
+	st := ix.Stats()
+	assert.Equal(t, 4, st.Indexed)
+	assert.Equal(t, 2, st.Unindexed)
+	assert.Equal(t, []string{"code", "product"}, st.Fields)
+
+	testcases := []struct {
+		input      map[string]interface{}
+		candidates []string
+	}{
+		{
+			input: map[string]interface{}{"tenant": "a", "product": "x", "amount": 20},
+			candidates: []string{
+				`tenant == "a" AND product == "x" AND amount > 10`,
+				`tenant == "b" AND product IN list("x", "y", "z")`,
+				`amount > 100`,
+				`tenant == "a" OR tenant == "b"`,
+			},
+		},
+		{
+			input: map[string]interface{}{"tenant": "b", "product": "q", "code": 2, "amount": 200},
+			candidates: []string{
+				`"b" == tenant AND code IN list(1, 2)`,
+				`amount > 100`,
+				`tenant == "a" OR tenant == "b"`,
+			},
+		},
+		{
+			input: map[string]interface{}{"code": "1"},
+			candidates: []string{
+				`"b" == tenant AND code IN list(1, 2)`,
+				`amount > 100`,
+				`tenant == "a" OR tenant == "b"`,
+			},
+		},
+	}
+
+	for i, tt := range testcases {
+		assert.Equal(t, tt.candidates, expressions(ix.Candidates(tt.input)), fmt.Sprintf("tests[%d] - candidates not equal", i))
+		assert.Equal(t, expressions(rs.Eval(tt.input)), expressions(ix.Eval(tt.input)), fmt.Sprintf("tests[%d] - matches not equal", i))
+	}
+}
+
+func TestIndexNumberEntries(t *testing.T) {
+	rs := newRuleSet(t, `amount IN list(1.0, 2.50)`)
+	ix := New(rs)
+	assert.Equal(t, 1, ix.Stats().Indexed)
+
+	// the entries are formatted like the list function does
+	for i, input := range []map[string]interface{}{
+		{"amount": 1},
+		{"amount": 2.5},
+		{"amount": "1"},
+		{"amount": 3},
+	} {
+		assert.Equal(t, expressions(rs.Eval(input)), expressions(ix.Eval(input)), fmt.Sprintf("tests[%d]", i))
+	}
+	assert.Len(t, ix.Eval(map[string]interface{}{"amount": 1}), 1)
+}
+
+func TestIndexEngineFunctions(t *testing.T) {
+	en := evaluator.NewEngine()
+	assert.NoError(t, en.Register("double", func(args []evaluator.Object) (evaluator.Object, error) {
+		return &evaluator.Number{Value: 2 * args[0].(*evaluator.Number).Value}, nil
+	}))
+
+	r, err := en.NewRule(`tenant == "a" AND double(amount) > 100`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rs := evaluator.NewRuleSet(r)
+
+	params := map[string]interface{}{"tenant": "a", "amount": 60}
+	assert.Len(t, rs.Eval(params), 1)
+	assert.Equal(t, rs.Eval(params), New(rs).Eval(params))
+}
+
+func BenchmarkIndex(b *testing.B) {
+	rs := evaluator.NewRuleSet()
+	for i := 0; i < 1000; i++ {
+		r, err := evaluator.NewRule(fmt.Sprintf(`tenant == "t%d" AND product == "p%d" AND amount > %d`, i%50, i%200, i), map[string]interface{}{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	ix := New(rs)
+	input := map[string]interface{}{"tenant": "t3", "product": "p53", "amount": 500}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix.Eval(input)
+	}
+}
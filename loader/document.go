@@ -0,0 +1,244 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+// Metadata keys set on compiled rules from the document fields
+const (
+	MetaID          = "id"
+	MetaDescription = "description"
+	MetaPriority    = "priority"
+	MetaTags        = "tags"
+	MetaVersion     = "version"
+)
+
+// metadata keys a document can't set itself
+var reservedMetadata = []string{MetaID, MetaDescription, MetaPriority, MetaTags, MetaVersion}
+
+// Document is the canonical definition of a rule
+type Document struct {
+	ID          string                 `json:"id" yaml:"id"`
+	Expression  string                 `json:"expression" yaml:"expression"`
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Priority    int                    `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Tags        []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// rules are enabled unless explicitly disabled
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Version int   `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// IsEnabled reports whether the rule should be compiled
+func (d Document) IsEnabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+// File is the top-level structure of a rule file
+type File struct {
+	Rules []Document `json:"rules" yaml:"rules"`
+}
+
+// Error is a problem with one rule document
+type Error struct {
+	Index   int // position of the document in the file
+	ID      string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("rules[%d]: %s", e.Index, e.Message)
+	}
+
+	return fmt.Sprintf("rules[%d] (%s): %s", e.Index, e.ID, e.Message)
+}
+
+// ErrorList collects every problem found in a set of documents
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, 0, len(l))
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// LoadJSON decodes and validates the documents of a JSON rule file
+func LoadJSON(r io.Reader) ([]Document, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid rule file: %w", err)
+	}
+
+	return f.Rules, Validate(f.Rules)
+}
+
+// LoadYAML decodes and validates the documents of a YAML rule file
+func LoadYAML(r io.Reader) ([]Document, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var f File
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid rule file: %w", err)
+	}
+
+	return f.Rules, Validate(f.Rules)
+}
+
+// LoadFile loads a rule file, the format is chosen by the file extension
+func LoadFile(path string) ([]Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadJSON(f)
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	default:
+		return nil, fmt.Errorf("unsupported rule file: %s", path)
+	}
+}
+
+// Validate checks the documents against the schema and RETURNS an ErrorList
+// holding every problem found, or nil
+func Validate(docs []Document) error {
+	errs := make(ErrorList, 0)
+	seen := make(map[string]int)
+
+	for i, d := range docs {
+		if strings.TrimSpace(d.ID) == "" {
+			errs = append(errs, &Error{Index: i, Message: "missing id"})
+		} else if prev, ok := seen[d.ID]; ok {
+			errs = append(errs, &Error{Index: i, ID: d.ID, Message: fmt.Sprintf("duplicate id, first defined at rules[%d]", prev)})
+		} else {
+			seen[d.ID] = i
+		}
+
+		if strings.TrimSpace(d.Expression) == "" {
+			errs = append(errs, &Error{Index: i, ID: d.ID, Message: "missing expression"})
+		}
+
+		if d.Version < 0 {
+			errs = append(errs, &Error{Index: i, ID: d.ID, Message: fmt.Sprintf("invalid version %d", d.Version)})
+		}
+
+		for _, tag := range d.Tags {
+			if strings.TrimSpace(tag) == "" {
+				errs = append(errs, &Error{Index: i, ID: d.ID, Message: "empty tag"})
+				break
+			}
+		}
+
+		for _, key := range reservedMetadata {
+			if _, ok := d.Metadata[key]; ok {
+				errs = append(errs, &Error{Index: i, ID: d.ID, Message: fmt.Sprintf("reserved metadata key %q", key)})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Compile validates and compiles the enabled documents, ordered by
+// descending priority. Either every document is valid and compiles or an
+// ErrorList reporting all the validation and compile failures is returned
+func Compile(docs []Document) (*evaluator.RuleSet, error) {
+	errs := make(ErrorList, 0)
+	if err := Validate(docs); err != nil {
+		errs = append(errs, err.(ErrorList)...)
+	}
+
+	type compiled struct {
+		doc  Document
+		rule *evaluator.Rule
+	}
+
+	rules := make([]compiled, 0, len(docs))
+	for i, d := range docs {
+		// a missing expression is reported by the validation
+		if !d.IsEnabled() || strings.TrimSpace(d.Expression) == "" {
+			continue
+		}
+
+		r, err := evaluator.NewRule(d.Expression, metadata(d))
+		if err != nil {
+			errs = append(errs, &Error{Index: i, ID: d.ID, Message: strings.ReplaceAll(err.Error(), "\n", "; ")})
+			continue
+		}
+
+		rules = append(rules, compiled{doc: d, rule: r})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].doc.Priority > rules[j].doc.Priority
+	})
+
+	rs := evaluator.NewRuleSet()
+	for _, c := range rules {
+		rs.Add(c.rule)
+	}
+
+	return rs, nil
+}
+
+// WriteJSON writes the documents in the canonical JSON format
+func WriteJSON(w io.Writer, docs []Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(File{Rules: docs})
+}
+
+// WriteYAML writes the documents in the canonical YAML format
+func WriteYAML(w io.Writer, docs []Document) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(File{Rules: docs}); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+func metadata(d Document) map[string]interface{} {
+	m := make(map[string]interface{}, len(d.Metadata)+5)
+	for k, v := range d.Metadata {
+		m[k] = v
+	}
+
+	m[MetaID] = d.ID
+	m[MetaDescription] = d.Description
+	m[MetaPriority] = d.Priority
+	m[MetaTags] = d.Tags
+	m[MetaVersion] = d.Version
+
+	return m
+}
@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonRules = `{
+  "rules": [
+    {"id": "de", "expression": "country == \"DE\"", "priority": 1, "tags": ["geo"]},
+    {"id": "big", "expression": "amount > 100", "description": "big spenders", "priority": 5, "metadata": {"team": "risk"}, "version": 2},
+    {"id": "off", "expression": "false", "enabled": false}
+  ]
+}`
+
+const yamlRules = `rules:
+  - id: de
+    expression: country == "DE"
+    priority: 1
+    tags: [geo]
+  - id: big
+    expression: amount > 100
+    description: big spenders
+    priority: 5
+    metadata:
+      team: risk
+    version: 2
+  - id: "off"
+    expression: "false"
+    enabled: false
+`
+
+func TestLoadAndCompile(t *testing.T) {
+	loaders := map[string]func(string) ([]Document, error){
+		"json": func(s string) ([]Document, error) { return LoadJSON(strings.NewReader(s)) },
+		"yaml": func(s string) ([]Document, error) { return LoadYAML(strings.NewReader(s)) },
+	}
+	sources := map[string]string{"json": jsonRules, "yaml": yamlRules}
+
+	for format, load := range loaders {
+		docs, err := load(sources[format])
+		assert.NoError(t, err, format)
+		assert.Len(t, docs, 3, format)
+		assert.False(t, docs[2].IsEnabled(), format)
+
+		rs, err := Compile(docs)
+		if !assert.NoError(t, err, format) {
+			continue
+		}
+
+		rules := rs.Rules()
+		assert.Len(t, rules, 2, format)
+		assert.Equal(t, "big", rules[0].GetMetadata(MetaID), format)
+		assert.Equal(t, "risk", rules[0].GetMetadata("team"), format)
+		assert.Equal(t, "de", rules[1].GetMetadata(MetaID), format)
+		assert.Len(t, rs.Eval(map[string]interface{}{"country": "DE", "amount": 500}), 2, format)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	docs, err := LoadJSON(strings.NewReader(`{"rules": [
+		{"id": "a", "expression": "x == 1"},
+		{"id": "a", "expression": ""},
+		{"expression": "x == 1", "version": -1, "tags": [""]},
+		{"id": "b", "expression": "x == 1", "metadata": {"version": 3, "team": "risk", "id": "x"}}
+	]}`))
+
+	assert.Len(t, docs, 4)
+	assert.EqualError(t, err, strings.Join([]string{
+		"rules[1] (a): duplicate id, first defined at rules[0]",
+		"rules[1] (a): missing expression",
+		"rules[2]: missing id",
+		"rules[2]: invalid version -1",
+		"rules[2]: empty tag",
+		`rules[3] (b): reserved metadata key "id"`,
+		`rules[3] (b): reserved metadata key "version"`,
+	}, "\n"))
+
+	_, err = LoadYAML(strings.NewReader("rules:\n  - id: a\n    expresion: x\n"))
+	assert.Error(t, err)
+
+	_, err = Compile([]Document{
+		{ID: "a", Expression: "x == "},
+		{ID: "b", Expression: "x == 1"},
+		{ID: "c", Expression: "(x"},
+	})
+	assert.EqualError(t, err, strings.Join([]string{
+		"rules[0] (a): no prefix parse function for EOF found",
+		"rules[2] (c): expected next token to be ), got EOF instead",
+	}, "\n"))
+
+	// the validation and compile errors are reported together
+	_, err = Compile([]Document{
+		{ID: "a", Expression: "x == "},
+		{ID: "a", Expression: "x == 1"},
+	})
+	var errs ErrorList
+	if assert.ErrorAs(t, err, &errs) {
+		assert.EqualError(t, errs, strings.Join([]string{
+			"rules[1] (a): duplicate id, first defined at rules[0]",
+			"rules[0] (a): no prefix parse function for EOF found",
+		}, "\n"))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	docs, err := LoadYAML(strings.NewReader(yamlRules))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteYAML(&buf, docs))
+	again, err := LoadYAML(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, docs, again)
+
+	docs, err = LoadJSON(strings.NewReader(jsonRules))
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, WriteJSON(&buf, docs))
+	again, err = LoadJSON(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, docs, again)
+}
@@ -0,0 +1,75 @@
+package loader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeParams decodes a JSON object into rule parameters. Arrays become
+// lists, of strings or of numbers; null values, mixed arrays and nested
+// objects have no rule type and are rejected
+func DecodeParams(r io.Reader) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	params := make(map[string]interface{}, len(raw))
+	for name, v := range raw {
+		p, err := ParamValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %q: %w", name, err)
+		}
+		params[name] = p
+	}
+
+	return params, nil
+}
+
+// ParamValue converts a decoded JSON value into a rule parameter
+func ParamValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string, float64, bool:
+		return v, nil
+	case []interface{}:
+		return listValue(v)
+	case nil:
+		return nil, errors.New("null value")
+	default:
+		return nil, fmt.Errorf("unsupported value %T", v)
+	}
+}
+
+// listValue RETURNS []string or []float64, an empty array is a string list
+func listValue(values []interface{}) (interface{}, error) {
+	if len(values) == 0 {
+		return []string{}, nil
+	}
+
+	switch values[0].(type) {
+	case string:
+		list := make([]string, 0, len(values))
+		for _, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("mixed list")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	case float64:
+		list := make([]float64, 0, len(values))
+		for _, v := range values {
+			n, ok := v.(float64)
+			if !ok {
+				return nil, errors.New("mixed list")
+			}
+			list = append(list, n)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unsupported list of %T", values[0])
+	}
+}
@@ -0,0 +1,37 @@
+package loader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeParams(t *testing.T) {
+	params, err := DecodeParams(strings.NewReader(`{"name": "a", "amount": 10.5, "ok": true, "tags": ["x", "y"], "scores": [1, 2], "none": []}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":   "a",
+		"amount": 10.5,
+		"ok":     true,
+		"tags":   []string{"x", "y"},
+		"scores": []float64{1, 2},
+		"none":   []string{},
+	}, params)
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"a": null}`, `invalid parameter "a": null value`},
+		{`{"a": {"b": 1}}`, `invalid parameter "a": unsupported value map[string]interface {}`},
+		{`{"a": ["x", 1]}`, `invalid parameter "a": mixed list`},
+		{`{"a": [true]}`, `invalid parameter "a": unsupported list of bool`},
+		{`[1]`, `invalid parameters: json: cannot unmarshal array into Go value of type map[string]interface {}`},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeParams(strings.NewReader(tt.input))
+		assert.EqualError(t, err, tt.err, tt.input)
+	}
+}
@@ -0,0 +1,260 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+type EventType string
+
+const (
+	Reloaded     EventType = "reloaded"
+	ReloadFailed EventType = "reload_failed"
+)
+
+// Event is reported to the source callback after every reload attempt
+type Event struct {
+	Type    EventType
+	Changed []string // files added, modified or removed
+	Rules   int      // number of active rules after the event
+	Err     error
+	Time    time.Time
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	docs    []Document
+	err     error
+}
+
+// FileSource serves the rules defined in the JSON and YAML files of a
+// directory. The directory is polled for changes; changed files are
+// reloaded and the active rule set is swapped only when every rule compiles
+type FileSource struct {
+	dir      string
+	interval time.Duration
+	onEvent  func(Event)
+
+	active atomic.Value // *evaluator.RuleSet
+
+	mtx   *sync.Mutex
+	files map[string]*fileState
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFileSource loads the rules of dir. It fails if the initial load fails.
+// onEvent may be nil, it is called without holding the source lock so it
+// may call the source back
+func NewFileSource(dir string, interval time.Duration, onEvent func(Event)) (*FileSource, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid poll interval: %s", interval)
+	}
+
+	s := &FileSource{
+		dir:      dir,
+		interval: interval,
+		onEvent:  onEvent,
+		mtx:      &sync.Mutex{},
+		files:    make(map[string]*fileState),
+	}
+
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Rules returns the active rule set
+func (s *FileSource) Rules() *evaluator.RuleSet {
+	return s.active.Load().(*evaluator.RuleSet)
+}
+
+// Start polls the directory in the background until Stop is called
+func (s *FileSource) Start() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.poll(s.stop, s.done)
+}
+
+// Stop stops polling and waits for the running reload to finish
+func (s *FileSource) Stop() {
+	s.mtx.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mtx.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+func (s *FileSource) poll(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.Reload()
+		}
+	}
+}
+
+// Reload checks the directory for changes and reloads the changed files.
+// It RETURNS whether the active rules were swapped; on failure the previous
+// rules stay active
+func (s *FileSource) Reload() (bool, error) {
+	s.mtx.Lock()
+	swapped, e, err := s.reload()
+	s.mtx.Unlock()
+
+	if e != nil {
+		s.emit(*e)
+	}
+
+	return swapped, err
+}
+
+// reload is Reload with the lock held, it RETURNS the event to report
+func (s *FileSource) reload() (bool, *Event, error) {
+	changed, err := s.scan()
+	if err != nil {
+		return false, s.event(Event{Type: ReloadFailed, Err: err}), err
+	}
+
+	if len(changed) == 0 && s.active.Load() != nil {
+		return false, nil, nil
+	}
+
+	rs, err := s.compile()
+	if err != nil {
+		return false, s.event(Event{Type: ReloadFailed, Changed: changed, Err: err}), err
+	}
+
+	s.active.Store(rs)
+	return true, s.event(Event{Type: Reloaded, Changed: changed}), nil
+}
+
+// scan updates the state of the files that changed since the last scan
+func (s *FileSource) scan() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	present := make(map[string]bool)
+
+	for _, e := range entries {
+		if e.IsDir() || !isRuleFile(e.Name()) {
+			continue
+		}
+
+		path := filepath.Join(s.dir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		present[path] = true
+		if st, ok := s.files[path]; ok && st.modTime.Equal(info.ModTime()) && st.size == info.Size() {
+			continue
+		}
+
+		docs, err := LoadFile(path)
+		s.files[path] = &fileState{modTime: info.ModTime(), size: info.Size(), docs: docs, err: err}
+		changed = append(changed, path)
+	}
+
+	for path := range s.files {
+		if !present[path] {
+			delete(s.files, path)
+			changed = append(changed, path)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// compile builds a rule set from the documents of every file
+func (s *FileSource) compile() (*evaluator.RuleSet, error) {
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	errs := make([]string, 0)
+	docs := make([]Document, 0)
+	for _, path := range paths {
+		st := s.files[path]
+		if st.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", path, strings.ReplaceAll(st.err.Error(), "\n", "\n"+path+": ")))
+			continue
+		}
+
+		docs = append(docs, st.docs...)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+
+	return Compile(docs)
+}
+
+// event completes e with the state of the source
+func (s *FileSource) event(e Event) *Event {
+	e.Time = time.Now()
+	if rs, ok := s.active.Load().(*evaluator.RuleSet); ok {
+		e.Rules = rs.Len()
+	}
+
+	return &e
+}
+
+func (s *FileSource) emit(e Event) {
+	if s.onEvent != nil {
+		s.onEvent(e)
+	}
+}
+
+func isRuleFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
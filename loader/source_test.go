@@ -0,0 +1,133 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRules(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// mtime resolution may be coarse, make every write visible
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSourceReload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeRules(t, filepath.Join(dir, "a.json"), `{"rules": [{"id": "a", "expression": "x == 1"}]}`, now)
+	writeRules(t, filepath.Join(dir, "b.yaml"), "rules:\n  - id: b\n    expression: x == 2\n", now)
+	writeRules(t, filepath.Join(dir, "notes.txt"), "ignored", now)
+
+	events := make([]Event, 0)
+	s, err := NewFileSource(dir, time.Second, func(e Event) { events = append(events, e) })
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, s.Rules().Len())
+
+	swapped, err := s.Reload()
+	assert.False(t, swapped)
+	assert.NoError(t, err)
+
+	// a broken file keeps the previous rules active
+	active := s.Rules()
+	writeRules(t, filepath.Join(dir, "b.yaml"), "rules:\n  - id: b\n    expression: x ==\n", now.Add(time.Second))
+	swapped, err = s.Reload()
+	assert.False(t, swapped)
+	assert.Error(t, err)
+	assert.Same(t, active, s.Rules())
+
+	writeRules(t, filepath.Join(dir, "b.yaml"), "rules:\n  - id: b\n    expression: x == 3\n  - id: c\n    expression: x == 4\n", now.Add(2*time.Second))
+	swapped, err = s.Reload()
+	assert.True(t, swapped)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, s.Rules().Len())
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a.json")))
+	swapped, err = s.Reload()
+	assert.True(t, swapped)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Rules().Len())
+
+	types := make([]EventType, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []EventType{Reloaded, ReloadFailed, Reloaded, Reloaded}, types)
+	assert.Equal(t, []string{filepath.Join(dir, "b.yaml")}, events[1].Changed)
+	assert.Equal(t, 2, events[1].Rules)
+	assert.Equal(t, 2, events[3].Rules)
+}
+
+func TestFileSourcePolling(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, filepath.Join(dir, "a.json"), `{"rules": []}`, time.Now())
+
+	reloaded := make(chan struct{}, 1)
+	var once sync.Once
+	s, err := NewFileSource(dir, 10*time.Millisecond, func(e Event) {
+		if e.Type == Reloaded && e.Rules == 1 {
+			once.Do(func() { close(reloaded) })
+		}
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s.Start()
+	defer s.Stop()
+
+	writeRules(t, filepath.Join(dir, "a.json"), `{"rules": [{"id": "a", "expression": "true"}]}`, time.Now().Add(time.Second))
+
+	select {
+	case <-reloaded:
+		assert.Equal(t, 1, s.Rules().Len())
+	case <-time.After(5 * time.Second):
+		t.Fatal("rules were not reloaded")
+	}
+}
+
+func TestFileSourceCallback(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, filepath.Join(dir, "a.json"), `{"rules": [{"id": "a", "expression": "x == 1"}]}`, time.Now())
+
+	_, err := NewFileSource(dir, 0, nil)
+	assert.Error(t, err)
+
+	// the callback may call the source back
+	var s *FileSource
+	rules := make(chan int, 4)
+	s, err = NewFileSource(dir, time.Second, func(e Event) {
+		if s != nil {
+			_, _ = s.Reload()
+			rules <- s.Rules().Len()
+		}
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	writeRules(t, filepath.Join(dir, "b.json"), `{"rules": [{"id": "b", "expression": "x == 2"}]}`, time.Now())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = s.Reload()
+	}()
+
+	select {
+	case <-done:
+		assert.Equal(t, 2, <-rules)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the callback deadlocked")
+	}
+}
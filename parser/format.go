@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Format RETURNS the canonical source of node: keywords in lower case,
+// single spaces around the operators and only the parentheses the
+// precedence requires. Formatting parses back to the same tree
+func Format(node Node) string {
+	switch node := node.(type) {
+	case *Rule:
+		if node.Statement == nil {
+			return ""
+		}
+		return Format(node.Statement)
+	case *ExpressionStatement:
+		if node.Expression == nil {
+			return ""
+		}
+		return Format(node.Expression)
+	case *Identifier:
+		return node.Value
+	case *ListName:
+		return "@" + node.Value
+	case *StringLiteral:
+		return `"` + node.Token.Literal + `"`
+	case *Regex:
+		return `r"` + node.Token.Literal + `"`
+	case *NumberLiteral:
+		return node.Token.Literal
+	case *BooleanLiteral:
+		return strings.ToLower(node.Token.Literal)
+	case *PrefixExpression:
+		right := Format(node.Right)
+		if _, ok := node.Right.(*InfixExpression); ok {
+			right = "(" + right + ")"
+		}
+		return node.Operator + right
+	case *InfixExpression:
+		prec := operatorPrecedence(node.Operator)
+
+		// operators are left associative, the right operand is grouped
+		// from the same precedence on
+		left := Format(node.Left)
+		if l, ok := node.Left.(*InfixExpression); ok && operatorPrecedence(l.Operator) < prec {
+			left = "(" + left + ")"
+		}
+		right := Format(node.Right)
+		if r, ok := node.Right.(*InfixExpression); ok && operatorPrecedence(r.Operator) <= prec {
+			right = "(" + right + ")"
+		}
+
+		return left + " " + strings.ToLower(node.Operator) + " " + right
+	case *CallExpression:
+		args := make([]string, 0, len(node.Arguments))
+		for _, a := range node.Arguments {
+			args = append(args, Format(a))
+		}
+		return Format(node.Function) + "(" + strings.Join(args, ", ") + ")"
+	case nil:
+		return ""
+	default:
+		return node.String()
+	}
+}
+
+func operatorPrecedence(operator string) int {
+	if t := LookupIdent(operator); t != IDENT {
+		return precendences[t]
+	}
+	return precendences[TokenType(operator)]
+}
+
+// Tree RETURNS node as an indented tree, one node per line
+func Tree(node Node) string {
+	var out bytes.Buffer
+	writeTree(&out, node, 0)
+	return out.String()
+}
+
+func writeTree(out *bytes.Buffer, node Node, depth int) {
+	line := func(format string, a ...interface{}) {
+		out.WriteString(strings.Repeat("  ", depth))
+		fmt.Fprintf(out, format, a...)
+		out.WriteString("\n")
+	}
+
+	switch node := node.(type) {
+	case *Rule:
+		line("Rule")
+		writeTree(out, node.Statement, depth+1)
+	case *ExpressionStatement:
+		line("ExpressionStatement")
+		writeTree(out, node.Expression, depth+1)
+	case *Identifier:
+		line("Identifier %s", node.Value)
+	case *ListName:
+		line("ListName @%s", node.Value)
+	case *StringLiteral:
+		line("StringLiteral %q", node.Value)
+	case *Regex:
+		line("Regex %q", node.Value)
+	case *NumberLiteral:
+		line("NumberLiteral %s", node.Token.Literal)
+	case *BooleanLiteral:
+		line("BooleanLiteral %t", node.Value)
+	case *PrefixExpression:
+		line("PrefixExpression %s", node.Operator)
+		writeTree(out, node.Right, depth+1)
+	case *InfixExpression:
+		line("InfixExpression %s", strings.ToLower(node.Operator))
+		writeTree(out, node.Left, depth+1)
+		writeTree(out, node.Right, depth+1)
+	case *CallExpression:
+		line("CallExpression %s", node.Function.String())
+		for _, a := range node.Arguments {
+			writeTree(out, a, depth+1)
+		}
+	case nil:
+		line("<nil>")
+	default:
+		line("%T %s", node, node.String())
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a==1", "a == 1"},
+		{"(a == 1) AND (b == 2)", "a == 1 and b == 2"},
+		{"a == 1 and (b == 2 or c == 3)", "a == 1 and (b == 2 or c == 3)"},
+		{"(a == 1 and b == 2) or c == 3", "a == 1 and b == 2 or c == 3"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"a * b / c", "a * b / c"},
+		{"(a * b) / c", "(a * b) / c"},
+		{"-(a + b) * c", "-(a + b) * c"},
+		{"name CONTAINS r\"^x+$\"", "name contains r\"^x+$\""},
+		{"ip IN @blocked", "ip in @blocked"},
+		{"TRUE", "true"},
+		{"upper(name,\"a\\\"b\")  ==  1.50", "upper(name, \"a\\\"b\") == 1.50"},
+		{"f()", "f()"},
+	}
+
+	for _, tt := range tests {
+		p := New(NewLexer(tt.input))
+		rule := p.ParseRule()
+		checkParserErrors(t, p)
+
+		formatted := Format(rule)
+		if formatted != tt.expected {
+			t.Errorf("Format(%q) = %q, expected %q", tt.input, formatted, tt.expected)
+		}
+
+		// the formatted rule parses back to the same tree, up to the case
+		// of the keywords
+		p = New(NewLexer(formatted))
+		again := p.ParseRule()
+		checkParserErrors(t, p)
+		if !strings.EqualFold(again.String(), rule.String()) {
+			t.Errorf("Format(%q) parses to %q, expected %q", tt.input, again.String(), rule.String())
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	p := New(NewLexer(`-a < f(r"x", @l) or b`))
+	rule := p.ParseRule()
+	checkParserErrors(t, p)
+
+	expected := `Rule
+  ExpressionStatement
+    InfixExpression or
+      InfixExpression <
+        PrefixExpression -
+          Identifier a
+        CallExpression f
+          Regex "x"
+          ListName @l
+      Identifier b
+`
+	if tree := Tree(rule); tree != expected {
+		t.Errorf("Tree() = %q, expected %q", tree, expected)
+	}
+}
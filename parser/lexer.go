@@ -86,6 +86,8 @@ func (l *Lexer) NextToken() Token {
 			tok.Literal = l.readString()
 			tok.Type = REGEX
 			l.readChar()
+
+			return tok
 		} else {
 			tok.Literal = l.readIdentifier()
 			tok.Type = LookupIdent(tok.Literal)
@@ -128,7 +130,7 @@ func (l *Lexer) readString() string {
 	pos := l.position
 
 	prevCh := ""
-	for (prevCh == "\\" && l.ch == '"') || l.ch != '"' {
+	for l.ch != 0 && ((prevCh == "\\" && l.ch == '"') || l.ch != '"') {
 		prevCh = string(l.ch)
 		l.readChar()
 	}
@@ -6,7 +6,7 @@ import (
 
 func TestNextToken(t *testing.T) {
 
-	input := `a == "category is not equal" OR (b == 10 AND c >=20.5) r"a.*"  LOWER(a)  != CONTAINS NOT_CONTAINS @LIST_345324 a BELOW(10) b`
+	input := `a == "category is not equal" OR (b == 10 AND c >=20.5) r"a.*"  LOWER(a)  != CONTAINS NOT_CONTAINS @LIST_345324 a BELOW(10) b IN any_match ALL_MATCH none_match f(r"\d",1)`
 
 	tests := []struct {
 		expected        TokenType
@@ -41,6 +41,16 @@ func TestNextToken(t *testing.T) {
 		{NUMBER, "10"},
 		{RPAREN, ")"},
 		{IDENT, "b"},
+		{IN, "IN"},
+		{ANYMATCH, "any_match"},
+		{ALLMATCH, "ALL_MATCH"},
+		{NONEMATCH, "none_match"},
+		{IDENT, "f"},
+		{LPAREN, "("},
+		{REGEX, `\d`},
+		{COMMA, ","},
+		{NUMBER, "1"},
+		{RPAREN, ")"},
 	}
 
 	lex := NewLexer(input)
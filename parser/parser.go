@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -15,6 +16,10 @@ var precendences = map[TokenType]int{
 	NOTEQUAL:    EQ,
 	CONTAINS:    EQ,
 	NOTCONTAINS: EQ,
+	IN:          EQ,
+	ANYMATCH:    EQ,
+	ALLMATCH:    EQ,
+	NONEMATCH:   EQ,
 	LT:          LESSGREATER,
 	LTE:         LESSGREATER,
 	GT:          LESSGREATER,
@@ -37,6 +42,15 @@ type Parser struct {
 
 	prefixParseFns map[TokenType]prefixParseFn
 	infixParseFns  map[TokenType]infixParseFn
+
+	// nesting of parseExpression calls, bounded by maxDepth when set
+	depth         int
+	maxDepth      int
+	depthExceeded bool
+
+	// tracing of the parse functions, disabled when traceOut is nil
+	traceOut   io.Writer
+	traceLevel int
 }
 
 func New(l *Lexer) *Parser {
@@ -76,6 +90,10 @@ func New(l *Lexer) *Parser {
 	p.registerInfix(LPAREN, p.parseCallExpression)
 	p.registerInfix(CONTAINS, p.parseInfixExpression)
 	p.registerInfix(NOTCONTAINS, p.parseInfixExpression)
+	p.registerInfix(IN, p.parseInfixExpression)
+	p.registerInfix(ANYMATCH, p.parseInfixExpression)
+	p.registerInfix(ALLMATCH, p.parseInfixExpression)
+	p.registerInfix(NONEMATCH, p.parseInfixExpression)
 
 	return p
 }
@@ -116,7 +134,22 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// SetMaxDepth bounds the nesting of the expressions, the parser stops at
+// the first expression nested deeper than max. Zero means no limit
+func (p *Parser) SetMaxDepth(max int) {
+	p.maxDepth = max
+}
+
+// DepthExceeded reports whether parsing stopped on the depth limit
+func (p *Parser) DepthExceeded() bool {
+	return p.depthExceeded
+}
+
 func (p *Parser) peekError(t TokenType) {
+	if p.depthExceeded {
+		return
+	}
+
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
@@ -131,6 +164,10 @@ func (p *Parser) registerInfix(tokenType TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) noPrefixParseFnError(t TokenType) {
+	if p.depthExceeded {
+		return
+	}
+
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
 	p.errors = append(p.errors, msg)
 }
@@ -163,7 +200,7 @@ func (p *Parser) ParseRule() *Rule {
 }
 
 func (p *Parser) parseExpressionStatement() *ExpressionStatement {
-	defer untrace(trace("parseExpressionStatement"))
+	defer p.untrace(p.trace("parseExpressionStatement"))
 
 	stmt := &ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -172,7 +209,23 @@ func (p *Parser) parseExpressionStatement() *ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) Expression {
-	defer untrace(trace("parseExpression"))
+	defer p.untrace(p.trace("parseExpression"))
+
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		if !p.depthExceeded {
+			p.depthExceeded = true
+			p.errors = append(p.errors, fmt.Sprintf("expression nested deeper than %d levels", p.maxDepth))
+		}
+
+		// the rest of the input is dropped so the callers unwind
+		for !p.curTokenIs(EOF) {
+			p.nextToken()
+		}
+		return nil
+	}
 
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
@@ -197,37 +250,37 @@ func (p *Parser) parseExpression(precedence int) Expression {
 }
 
 func (p *Parser) parseIdentifier() Expression {
-	defer untrace(trace("parseIdentifier"))
+	defer p.untrace(p.trace("parseIdentifier"))
 
 	return &Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseBooleanLiteral() Expression {
-	defer untrace(trace("parseBooleanLIteral"))
+	defer p.untrace(p.trace("parseBooleanLIteral"))
 
 	return &BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(TRUE)}
 }
 
 func (p *Parser) parseStringLiteral() Expression {
-	defer untrace(trace("parseStringLiteral"))
+	defer p.untrace(p.trace("parseStringLiteral"))
 
 	return &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseList() Expression {
-	defer untrace(trace("parseList"))
+	defer p.untrace(p.trace("parseList"))
 
 	return &ListName{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseRegex() Expression {
-	defer untrace(trace("parseRegex"))
+	defer p.untrace(p.trace("parseRegex"))
 
 	return &Regex{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseGroupedExpression() Expression {
-	defer untrace(trace("parseGroupedExpression"))
+	defer p.untrace(p.trace("parseGroupedExpression"))
 
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
@@ -239,7 +292,7 @@ func (p *Parser) parseGroupedExpression() Expression {
 }
 
 func (p *Parser) parseNumberLiteral() Expression {
-	defer untrace(trace("parseNumberLiteral"))
+	defer p.untrace(p.trace("parseNumberLiteral"))
 
 	lit := &NumberLiteral{Token: p.curToken}
 
@@ -254,7 +307,7 @@ func (p *Parser) parseNumberLiteral() Expression {
 }
 
 func (p *Parser) parsePrefixExpression() Expression {
-	defer untrace(trace("parsePrefixExpression"))
+	defer p.untrace(p.trace("parsePrefixExpression"))
 
 	exp := &PrefixExpression{
 		Token:    p.curToken,
@@ -268,7 +321,7 @@ func (p *Parser) parsePrefixExpression() Expression {
 }
 
 func (p *Parser) parseInfixExpression(leftExp Expression) Expression {
-	defer untrace(trace("parseInfixExpression"))
+	defer p.untrace(p.trace("parseInfixExpression"))
 
 	exp := &InfixExpression{
 		Token:    p.curToken,
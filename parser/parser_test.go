@@ -65,6 +65,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a == \"category name\" OR true",
 			"((a == \"category name\") OR true)",
 		},
+		{
+			"a in list(1, 2) AND b",
+			"((a in list(1, 2)) AND b)",
+		},
 		{
 			"a == r\"category name\" OR true",
 			"((a == \"category name\") OR true)",
@@ -94,3 +98,20 @@ func TestInfo(t *testing.T) {
 	}
 
 }
+
+func TestMaxDepth(t *testing.T) {
+	p := New(NewLexer("((a)) == f((b))"))
+	p.SetMaxDepth(4)
+	p.ParseRule()
+	checkParserErrors(t, p)
+
+	p = New(NewLexer("(((((((((a == 1)))))))))) and b"))
+	p.SetMaxDepth(3)
+	p.ParseRule()
+	if !p.DepthExceeded() {
+		t.Fatalf("expected the depth limit to be exceeded")
+	}
+	if len(p.Errors()) != 1 || p.Errors()[0] != "expression nested deeper than 3 levels" {
+		t.Fatalf("unexpected errors: %q", p.Errors())
+	}
+}
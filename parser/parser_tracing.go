@@ -2,34 +2,38 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
-var enabled = false
-var traceLevel int = 0
-
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// SetTrace writes the parse functions entered and left by the parser to w,
+// a nil writer disables tracing
+func (p *Parser) SetTrace(w io.Writer) {
+	p.traceOut = w
+}
+
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
 }
 
-func tracePrint(fs string) {
-	if enabled {
-		fmt.Printf("%s%s\n", identLevel(), fs)
+func (p *Parser) tracePrint(fs string) {
+	if p.traceOut != nil {
+		fmt.Fprintf(p.traceOut, "%s%s\n", p.identLevel(), fs)
 	}
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (p *Parser) incIdent() { p.traceLevel = p.traceLevel + 1 }
+func (p *Parser) decIdent() { p.traceLevel = p.traceLevel - 1 }
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	p.tracePrint("BEGIN " + msg)
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	p.tracePrint("END " + msg)
+	p.decIdent()
 }
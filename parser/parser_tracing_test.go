@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+
+	p := New(NewLexer("a == 1"))
+	p.SetTrace(&out)
+	p.ParseRule()
+	checkParserErrors(t, p)
+
+	expected := "BEGIN parseExpressionStatement\n" +
+		"\tBEGIN parseExpression\n" +
+		"\t\tBEGIN parseIdentifier\n" +
+		"\t\tEND parseIdentifier\n" +
+		"\t\tBEGIN parseInfixExpression\n" +
+		"\t\t\tBEGIN parseExpression\n" +
+		"\t\t\t\tBEGIN parseNumberLiteral\n" +
+		"\t\t\t\tEND parseNumberLiteral\n" +
+		"\t\t\tEND parseExpression\n" +
+		"\t\tEND parseInfixExpression\n" +
+		"\tEND parseExpression\n" +
+		"END parseExpressionStatement\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected trace:\n%s", out.String())
+	}
+
+	// parsers trace independently of each other
+	p = New(NewLexer("a == 1"))
+	p.ParseRule()
+	if out.Len() != len(expected) {
+		t.Fatalf("a parser without tracing wrote to the trace")
+	}
+}
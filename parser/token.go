@@ -32,6 +32,10 @@ const (
 	NOTEQUAL    = "!="
 	CONTAINS    = "CONTAINS"
 	NOTCONTAINS = "NOT_CONTAINS"
+	IN          = "IN"
+	ANYMATCH    = "ANY_MATCH"
+	ALLMATCH    = "ALL_MATCH"
+	NONEMATCH   = "NONE_MATCH"
 
 	LPAREN      = "("
 	RPAREN      = ")"
@@ -54,6 +58,10 @@ var keywords = map[string]TokenType{
 	"or":           OR,
 	"contains":     CONTAINS,
 	"not_contains": NOTCONTAINS,
+	"in":           IN,
+	"any_match":    ANYMATCH,
+	"all_match":    ALLMATCH,
+	"none_match":   NONEMATCH,
 	"true":         TRUE,
 	"false":        FALSE,
 }
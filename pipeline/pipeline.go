@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/queue"
+)
+
+// ErrNotStarted is returned by Shutdown when the pipeline was not started
+var ErrNotStarted = errors.New("pipeline not started")
+
+// Stage tells where an event failed
+type Stage string
+
+const (
+	StageEval    Stage = "eval"
+	StageDeliver Stage = "deliver"
+)
+
+// Match is delivered to the subscribers for every event matching rules
+type Match struct {
+	Event map[string]interface{}
+	Rules []*evaluator.Rule
+	// rules of the set that failed to evaluate against the event
+	Failures []*evaluator.Failure
+}
+
+// DeadLetter is an event that failed to be evaluated or delivered. An event
+// fails to be evaluated when none of the rules could be
+type DeadLetter struct {
+	Event map[string]interface{}
+	Err   error
+	Stage Stage
+	Time  time.Time
+}
+
+// Subscriber receives the matches of the pipeline. Deliver is called from
+// the workers, concurrently. An error sends the event to the dead-letter queue
+type Subscriber interface {
+	Deliver(m Match) error
+}
+
+// SubscriberFunc adapts a function to the Subscriber interface
+type SubscriberFunc func(m Match) error
+
+func (f SubscriberFunc) Deliver(m Match) error { return f(m) }
+
+// Options configures a pipeline
+type Options struct {
+	// evaluating goroutines, GOMAXPROCS when zero
+	Workers int
+	// events waiting for a worker, publishers block while it is reached.
+	// Unbounded when zero
+	Capacity int
+	// queue of the events, e.g. a queue.PersistentQueue to keep them across
+	// restarts. An in-memory queue of Capacity when nil
+	Queue queue.FIFO[map[string]interface{}]
+	// derives the context evaluating an event from the context of the
+	// worker, e.g. to pass the event time to aggregate.Aggregator.Observe
+	EventContext func(ctx context.Context, event map[string]interface{}) context.Context
+}
+
+// Stats counts the events processed by the pipeline
+type Stats struct {
+	Published int64
+	Processed int64
+	Matched   int64
+	Failed    int64
+	// rules failing to evaluate against an event, the event may still match
+	// the other rules
+	RuleErrors int64
+}
+
+// receiver is implemented by the queues acknowledging their items, like
+// queue.PersistentQueue. Their events are only acknowledged once processed
+type receiver interface {
+	Receive(ctx context.Context) (*queue.Delivery[map[string]interface{}], error)
+}
+
+// Pipeline evaluates a rule set against the events published to it with
+// a pool of workers, and delivers the matches to its subscribers
+type Pipeline struct {
+	// first so they are 64-bit aligned for the atomic operations
+	published, processed, matched, failed, ruleErrors int64
+
+	rules        *evaluator.RuleSet
+	workers      int
+	eventContext func(ctx context.Context, event map[string]interface{}) context.Context
+
+	events queue.FIFO[map[string]interface{}]
+	dead   *queue.Queue[DeadLetter]
+
+	mtx         *sync.RWMutex
+	subscribers []Subscriber
+
+	started int32
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	// Now returns the current time, it can be replaced in tests
+	Now func() time.Time
+}
+
+func New(rules *evaluator.RuleSet, opts Options) *Pipeline {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	events := opts.Queue
+	if events == nil {
+		events = queue.NewBounded[map[string]interface{}](opts.Capacity)
+	}
+
+	return &Pipeline{
+		rules:        rules,
+		workers:      workers,
+		eventContext: opts.EventContext,
+		events:       events,
+		dead:         queue.New[DeadLetter](),
+		mtx:          &sync.RWMutex{},
+		Now:          time.Now,
+	}
+}
+
+// Subscribe adds a subscriber receiving the matches of the events
+// processed from now on
+func (p *Pipeline) Subscribe(s Subscriber) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.subscribers = append(p.subscribers, s)
+}
+
+// Start starts the workers, starting twice is a no-op
+func (p *Pipeline) Start() {
+	if !atomic.CompareAndSwapInt32(&p.started, 0, 1) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+}
+
+// Publish enqueues the event, waiting for room while the pipeline is at
+// capacity. It RETURNS queue.ErrClosed once the pipeline is shut down
+func (p *Pipeline) Publish(ctx context.Context, event map[string]interface{}) error {
+	if err := p.events.Enqueue(ctx, event); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&p.published, 1)
+	return nil
+}
+
+// TryPublish enqueues the event without waiting, it RETURNS queue.ErrFull
+// when the pipeline is at capacity
+func (p *Pipeline) TryPublish(event map[string]interface{}) error {
+	if err := p.events.TryEnqueue(event); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&p.published, 1)
+	return nil
+}
+
+// DeadLetters returns the queue of the failed events, it is closed once
+// the pipeline is shut down
+func (p *Pipeline) DeadLetters() *queue.Queue[DeadLetter] {
+	return p.dead
+}
+
+// Shutdown stops accepting events and waits for the workers to process the
+// events already published. When ctx is done first the workers are stopped,
+// the events left are dropped and the error of ctx is returned. A queue
+// acknowledging its events keeps them, the interrupted ones included
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	if atomic.LoadInt32(&p.started) == 0 {
+		return ErrNotStarted
+	}
+
+	p.events.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		p.cancel()
+		<-drained
+		err = ctx.Err()
+	}
+
+	p.cancel()
+	p.dead.Close()
+	return err
+}
+
+// Stats returns the event counters
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Published: atomic.LoadInt64(&p.published),
+		Processed: atomic.LoadInt64(&p.processed),
+		Matched:   atomic.LoadInt64(&p.matched),
+		Failed:    atomic.LoadInt64(&p.failed),
+
+		RuleErrors: atomic.LoadInt64(&p.ruleErrors),
+	}
+}
+
+func (p *Pipeline) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	r, acks := p.events.(receiver)
+
+	// a forced shutdown drops the events left even though they are available
+	for ctx.Err() == nil {
+		if !acks {
+			event, err := p.events.Dequeue(ctx)
+			if err != nil {
+				return
+			}
+
+			p.process(ctx, event, false)
+			atomic.AddInt64(&p.processed, 1)
+			continue
+		}
+
+		d, err := r.Receive(ctx)
+		if err != nil {
+			return
+		}
+
+		// the interrupted event is delivered again once the queue is reopened
+		if !p.process(ctx, d.Item, true) {
+			_ = d.Nack()
+			return
+		}
+
+		_ = d.Ack()
+		atomic.AddInt64(&p.processed, 1)
+	}
+}
+
+// process evaluates the event and delivers its matches. It RETURNS false
+// when the evaluation is interrupted and redeliver is set, the event is not
+// dead-lettered then
+func (p *Pipeline) process(ctx context.Context, event map[string]interface{}, redeliver bool) bool {
+	matched, failures, err := p.evaluate(ctx, event)
+	if err != nil && redeliver && ctx.Err() != nil {
+		return false
+	}
+
+	atomic.AddInt64(&p.ruleErrors, int64(len(failures)))
+	switch {
+	case err != nil:
+		p.fail(event, StageEval, err)
+		return true
+	case len(failures) > 0 && len(failures) == p.rules.Len():
+		// the rules failing alone don't fail the event
+		p.fail(event, StageEval, failures[0])
+		return true
+	case len(matched) == 0:
+		return true
+	}
+
+	atomic.AddInt64(&p.matched, 1)
+
+	p.mtx.RLock()
+	subscribers := p.subscribers
+	p.mtx.RUnlock()
+
+	m := Match{Event: event, Rules: matched, Failures: failures}
+	for _, s := range subscribers {
+		if err := deliver(s, m); err != nil {
+			p.fail(event, StageDeliver, err)
+		}
+	}
+
+	return true
+}
+
+func (p *Pipeline) evaluate(ctx context.Context, event map[string]interface{}) (matched []*evaluator.Rule, failures []*evaluator.Failure, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("evaluation panicked: %v", r)
+		}
+	}()
+
+	if p.eventContext != nil {
+		ctx = p.eventContext(ctx, event)
+	}
+	return p.rules.EvalFailures(ctx, event)
+}
+
+func deliver(s Subscriber, m Match) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked: %v", r)
+		}
+	}()
+
+	return s.Deliver(m)
+}
+
+func (p *Pipeline) fail(event map[string]interface{}, stage Stage, err error) {
+	atomic.AddInt64(&p.failed, 1)
+	// the dead-letter queue is unbounded and only closed after the workers
+	_ = p.dead.TryEnqueue(DeadLetter{Event: event, Err: err, Stage: stage, Time: p.Now()})
+}
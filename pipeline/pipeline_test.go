@@ -0,0 +1,245 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/queue"
+)
+
+func ruleSet(t *testing.T, exprs ...string) *evaluator.RuleSet {
+	rs := evaluator.NewRuleSet()
+	for _, expr := range exprs {
+		r, err := evaluator.NewRule(expr, map[string]interface{}{"expr": expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+func TestPipeline(t *testing.T) {
+	p := New(ruleSet(t, `amount > 100`, `country == "DE"`), Options{Workers: 4, Capacity: 8})
+
+	var mtx sync.Mutex
+	received := make(map[int][]string)
+	p.Subscribe(SubscriberFunc(func(m Match) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		for _, r := range m.Rules {
+			received[m.Event["id"].(int)] = append(received[m.Event["id"].(int)], r.GetMetadata("expr").(string))
+		}
+		return nil
+	}))
+	p.Start()
+	p.Start()
+
+	for i := 0; i < 100; i++ {
+		event := map[string]interface{}{"id": i, "amount": i * 2, "country": "FR"}
+		if i%10 == 0 {
+			event["country"] = "DE"
+		}
+		assert.NoError(t, p.Publish(context.Background(), event))
+	}
+
+	// the events published before the shutdown are all processed
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, queue.ErrClosed, p.Publish(context.Background(), map[string]interface{}{}))
+
+	st := p.Stats()
+	assert.Equal(t, Stats{Published: 100, Processed: 100, Matched: 55}, st)
+
+	assert.Equal(t, []string{`amount > 100`, `country == "DE"`}, sortedCopy(received[90]))
+	assert.Equal(t, []string{`amount > 100`}, received[51])
+	assert.Equal(t, []string{`country == "DE"`}, received[10])
+	assert.Nil(t, received[11])
+}
+
+func TestDeadLetters(t *testing.T) {
+	p := New(ruleSet(t, `amount > 100`), Options{Workers: 2})
+	p.Now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	boom := errors.New("boom")
+	p.Subscribe(SubscriberFunc(func(m Match) error {
+		if m.Event["id"] == "refused" {
+			return boom
+		}
+		if m.Event["id"] == "panic" {
+			panic("subscriber bug")
+		}
+		return nil
+	}))
+	p.Start()
+
+	for _, event := range []map[string]interface{}{
+		{"id": "ok", "amount": 200},
+		{"id": "missing"},
+		{"id": "refused", "amount": 300},
+		{"id": "panic", "amount": 400},
+	} {
+		assert.NoError(t, p.TryPublish(event))
+	}
+	assert.NoError(t, p.Shutdown(context.Background()))
+
+	letters := make(map[string]DeadLetter)
+	for {
+		dl, err := p.DeadLetters().Dequeue(context.Background())
+		if err != nil {
+			assert.Equal(t, queue.ErrClosed, err)
+			break
+		}
+		letters[dl.Event["id"].(string)] = dl
+	}
+
+	if assert.Len(t, letters, 3) {
+		assert.Equal(t, StageEval, letters["missing"].Stage)
+		assert.Contains(t, letters["missing"].Err.Error(), "identifier not found: amount")
+		assert.Equal(t, StageDeliver, letters["refused"].Stage)
+		assert.Equal(t, boom, letters["refused"].Err)
+		assert.EqualError(t, letters["panic"].Err, "subscriber panicked: subscriber bug")
+		assert.Equal(t, p.Now(), letters["panic"].Time)
+	}
+	assert.Equal(t, int64(3), p.Stats().Failed)
+}
+
+func TestRuleErrors(t *testing.T) {
+	p := New(ruleSet(t, `country == "DE"`, `email contains "x"`), Options{Workers: 1})
+
+	var mtx sync.Mutex
+	delivered := make([]Match, 0)
+	p.Subscribe(SubscriberFunc(func(m Match) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		delivered = append(delivered, m)
+		return nil
+	}))
+	p.Start()
+
+	// a rule failing on a missing field doesn't drop the matches of the others
+	assert.NoError(t, p.TryPublish(map[string]interface{}{"country": "DE"}))
+	assert.NoError(t, p.TryPublish(map[string]interface{}{"country": "FR"}))
+	// nothing could be evaluated
+	assert.NoError(t, p.TryPublish(map[string]interface{}{}))
+	assert.NoError(t, p.Shutdown(context.Background()))
+
+	if assert.Len(t, delivered, 1) {
+		assert.Equal(t, `country == "DE"`, delivered[0].Rules[0].GetMetadata("expr"))
+		if assert.Len(t, delivered[0].Failures, 1) {
+			assert.EqualError(t, delivered[0].Failures[0], `rule "email contains \"x\"": eval: identifier not found: email`)
+		}
+	}
+
+	assert.Equal(t, Stats{Published: 3, Processed: 3, Matched: 1, Failed: 1, RuleErrors: 4}, p.Stats())
+	assert.Equal(t, 1, p.DeadLetters().Length())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	p := New(ruleSet(t, `amount > 0`), Options{Workers: 1})
+
+	release := make(chan struct{})
+	p.Subscribe(SubscriberFunc(func(m Match) error {
+		<-release
+		return nil
+	}))
+	p.Start()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, p.TryPublish(map[string]interface{}{"amount": 1}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		time.Sleep(40 * time.Millisecond)
+		close(release)
+	}()
+	err := p.Shutdown(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, p.Stats().Processed, int64(5))
+
+	assert.Equal(t, ErrNotStarted, New(ruleSet(t), Options{}).Shutdown(context.Background()))
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string{}, s...)
+	sort.Strings(c)
+	return c
+}
+
+func TestPersistentEvents(t *testing.T) {
+	events, err := queue.OpenPersistent[map[string]interface{}](t.TempDir(), queue.PersistentOptions{Sync: queue.SyncNever})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer events.Stop()
+
+	p := New(ruleSet(t, `amount > 100`), Options{Workers: 2, Queue: events})
+
+	var mtx sync.Mutex
+	matched := 0
+	p.Subscribe(SubscriberFunc(func(m Match) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		matched++
+		return nil
+	}))
+	p.Start()
+
+	// events go through JSON, numbers come back as float64
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Publish(context.Background(), map[string]interface{}{"amount": 95 + i}))
+	}
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, 4, matched)
+	assert.Equal(t, 0, events.Length())
+}
+
+func TestPersistentEventsInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	events, err := queue.OpenPersistent[map[string]interface{}](dir, queue.PersistentOptions{Sync: queue.SyncNever})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the event is being processed when the pipeline is stopped
+	started := make(chan struct{})
+	p := New(ruleSet(t, `amount > 100`), Options{Workers: 1, Queue: events, EventContext: func(ctx context.Context, event map[string]interface{}) context.Context {
+		close(started)
+		<-ctx.Done()
+		return ctx
+	}})
+	p.Start()
+
+	assert.NoError(t, p.Publish(context.Background(), map[string]interface{}{"amount": 150}))
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, p.Shutdown(ctx))
+	assert.Equal(t, 0, p.DeadLetters().Length())
+	assert.Equal(t, int64(0), p.Stats().Processed)
+	assert.NoError(t, events.Stop())
+
+	// the event comes back once the queue is reopened
+	events, err = queue.OpenPersistent[map[string]interface{}](dir, queue.PersistentOptions{Sync: queue.SyncNever})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer events.Stop()
+
+	assert.Equal(t, 1, events.Length())
+	event, ok := events.TryDequeue()
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"amount": float64(150)}, event)
+}
@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the delay queue, it can be replaced in tests
+type Clock interface {
+	Now() time.Time
+	// NewTimer RETURNS a timer sending the time once d elapsed
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the time once on C, Stop releases it when it is not needed
+// anymore
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it RETURNS false when the timer
+	// already fired or was stopped
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                 { return time.Now() }
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+// SystemClock is the clock of the running system
+var SystemClock Clock = systemClock{}
+
+// DelayQueue releases its items at their scheduled time, items scheduled
+// for the same time in insertion order. It is safe for concurrent use
+type DelayQueue[T any] struct {
+	mtx    *sync.Mutex
+	clock  Clock
+	heap   entryHeap[T]
+	closed bool
+	signal signal
+}
+
+// NewDelay RETURNS a delay queue using clock, the system clock when nil
+func NewDelay[T any](clock Clock) *DelayQueue[T] {
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	return &DelayQueue[T]{mtx: &sync.Mutex{}, clock: clock, signal: newSignal()}
+}
+
+// Schedule adds the item to be released at, a zero time meaning now. It
+// RETURNS ErrClosed once the queue is closed
+func (q *DelayQueue[T]) Schedule(item T, at time.Time) error {
+	if at.IsZero() {
+		at = q.clock.Now()
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.heap.push(item, unixNano(at))
+	q.signal.notify()
+	return nil
+}
+
+// ScheduleAfter adds the item to be released once d elapsed
+func (q *DelayQueue[T]) ScheduleAfter(item T, d time.Duration) error {
+	return q.Schedule(item, q.clock.Now().Add(d))
+}
+
+// Dequeue removes the earliest item and RETURNS it once it is due, waiting
+// for it. Once the queue is closed the items already due are returned,
+// then ErrClosed
+func (q *DelayQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	var zero T
+
+	for {
+		q.mtx.Lock()
+		var timer Timer
+		var due <-chan time.Time
+		if q.heap.len() > 0 {
+			rank, now := q.heap.peek().rank, unixNano(q.clock.Now())
+			if rank <= now {
+				item := q.heap.pop().item
+				q.mtx.Unlock()
+				return item, nil
+			}
+			if !q.closed {
+				timer = q.clock.NewTimer(time.Duration(rank - now))
+				due = timer.C()
+			}
+		}
+		if q.closed {
+			q.mtx.Unlock()
+			return zero, ErrClosed
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		var err error
+		select {
+		case <-due:
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		// the timer is not needed anymore, the next round schedules a new one
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return zero, err
+		}
+	}
+}
+
+// TryDequeue removes the earliest item and RETURNS it when it is due, ok
+// is false otherwise
+func (q *DelayQueue[T]) TryDequeue() (item T, ok bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.heap.len() == 0 || q.heap.peek().rank > unixNano(q.clock.Now()) {
+		return item, false
+	}
+
+	return q.heap.pop().item, true
+}
+
+// Next RETURNS the scheduled time of the earliest item, ok is false when
+// the queue is empty
+func (q *DelayQueue[T]) Next() (at time.Time, ok bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.heap.len() == 0 {
+		return at, false
+	}
+
+	return time.Unix(0, q.heap.peek().rank), true
+}
+
+// Close stops the queue from accepting items and wakes up the waiting
+// consumers. The items not due yet are not released anymore
+func (q *DelayQueue[T]) Close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.closed = true
+	q.signal.notify()
+}
+
+// Items returns a copy of the queue items in release order
+func (q *DelayQueue[T]) Items() []T {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.heap.items()
+}
+
+// Length returns the number of items, due or not
+func (q *DelayQueue[T]) Length() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.heap.len()
+}
+
+var (
+	minUnixNano = time.Unix(0, math.MinInt64)
+	maxUnixNano = time.Unix(0, math.MaxInt64)
+)
+
+// unixNano is at.UnixNano() clamped to the times it can represent, the
+// result is undefined otherwise
+func unixNano(at time.Time) int64 {
+	switch {
+	case at.Before(minUnixNano):
+		return math.MinInt64
+	case at.After(maxUnixNano):
+		return math.MaxInt64
+	default:
+		return at.UnixNano()
+	}
+}
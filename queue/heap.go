@@ -0,0 +1,88 @@
+package queue
+
+// entry is an item of the heap based queues, seq orders the entries of
+// equal rank by insertion
+type entry[T any] struct {
+	item T
+	rank int64
+	seq  uint64
+}
+
+// entryHeap is a binary min heap of entries ordered by rank then seq
+type entryHeap[T any] struct {
+	entries []entry[T]
+	seq     uint64
+}
+
+func (h *entryHeap[T]) less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if a.rank != b.rank {
+		return a.rank < b.rank
+	}
+	return a.seq < b.seq
+}
+
+func (h *entryHeap[T]) push(item T, rank int64) {
+	h.seq++
+	h.entries = append(h.entries, entry[T]{item: item, rank: rank, seq: h.seq})
+
+	// sift up
+	i := len(h.entries) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.entries[i], h.entries[parent] = h.entries[parent], h.entries[i]
+		i = parent
+	}
+}
+
+func (h *entryHeap[T]) peek() entry[T] {
+	return h.entries[0]
+}
+
+func (h *entryHeap[T]) pop() entry[T] {
+	top := h.entries[0]
+	last := len(h.entries) - 1
+	h.entries[0] = h.entries[last]
+	// release the reference held by the backing array
+	h.entries[last] = entry[T]{}
+	h.entries = h.entries[:last]
+
+	// sift down
+	i := 0
+	for {
+		smallest, l, r := i, 2*i+1, 2*i+2
+		if l < len(h.entries) && h.less(l, smallest) {
+			smallest = l
+		}
+		if r < len(h.entries) && h.less(r, smallest) {
+			smallest = r
+		}
+		if smallest == i {
+			break
+		}
+		h.entries[i], h.entries[smallest] = h.entries[smallest], h.entries[i]
+		i = smallest
+	}
+
+	return top
+}
+
+func (h *entryHeap[T]) len() int {
+	return len(h.entries)
+}
+
+// items RETURNS the items in rank order without modifying the heap
+func (h *entryHeap[T]) items() []T {
+	c := &entryHeap[T]{entries: make([]entry[T], len(h.entries))}
+	copy(c.entries, h.entries)
+
+	items := make([]T, 0, len(h.entries))
+	for c.len() > 0 {
+		items = append(items, c.pop().item)
+	}
+
+	return items
+}
@@ -0,0 +1,782 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownDelivery is returned when acknowledging an item that is not in flight
+var ErrUnknownDelivery = errors.New("unknown delivery")
+
+// SyncPolicy tells when the persistent queue flushes its writes to disk
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes every write before returning, nothing acknowledged
+	// by the queue is lost on a crash
+	SyncAlways SyncPolicy = iota
+	// SyncInterval flushes the writes every SyncInterval, a crash loses the
+	// writes of the last interval
+	SyncInterval
+	// SyncNever leaves the flushing to the operating system
+	SyncNever
+)
+
+// PersistentOptions configures a persistent queue
+type PersistentOptions struct {
+	// size of a segment file before a new one is started, 16MiB when zero
+	SegmentSize int64
+	Sync        SyncPolicy
+	// period of SyncInterval, one second when zero
+	SyncInterval time.Duration
+	// pending items, producers block while it is reached. Unbounded when zero
+	Capacity int
+}
+
+const (
+	segmentPrefix = "segment-"
+	segmentExt    = ".log"
+
+	recordItem byte = 1
+	recordAck  byte = 2
+
+	// length and checksum of the payload
+	recordHeaderSize = 8
+	// type and id at the start of the payload
+	payloadHeaderSize = 9
+)
+
+// segment is a file of the log, holding the items with ids in [first, last]
+type segment struct {
+	seq   uint64
+	path  string
+	size  int64
+	first uint64
+	last  uint64
+	items int
+	// items of the segment not acknowledged yet
+	live int
+}
+
+type pendingItem[T any] struct {
+	id   uint64
+	item T
+}
+
+// Delivery is an item received from a persistent queue, it stays on disk
+// until it is acknowledged
+type Delivery[T any] struct {
+	ID   uint64
+	Item T
+	q    *PersistentQueue[T]
+}
+
+// Ack removes the item from the queue for good
+func (d *Delivery[T]) Ack() error { return d.q.ack(d.ID) }
+
+// Nack returns the item to the head of the queue to be delivered again
+func (d *Delivery[T]) Nack() error { return d.q.nack(d.ID) }
+
+// PersistentQueue is a FIFO queue backed by an append-only log of segment
+// files in a directory. Items are written to the log when enqueued and an
+// acknowledgement is written when they are consumed, so the items received
+// but not acknowledged are delivered again once the queue is reopened.
+// Items are encoded as JSON. It is safe for concurrent use
+type PersistentQueue[T any] struct {
+	mtx  *sync.Mutex
+	dir  string
+	opts PersistentOptions
+
+	segments []*segment // oldest first, the last one is written to
+	active   *os.File
+	writer   *bufio.Writer
+	nextID   uint64
+	dirty    bool
+
+	pending  []pendingItem[T]
+	inflight map[uint64]pendingItem[T]
+
+	closed  bool
+	stopped bool
+	signal  signal
+	done    chan struct{}
+}
+
+var _ FIFO[int] = (*PersistentQueue[int])(nil)
+
+// OpenPersistent opens the queue stored in dir, creating it when needed.
+// The items not acknowledged before the queue was last stopped are pending
+// again, in their original order
+func OpenPersistent[T any](dir string, opts PersistentOptions) (*PersistentQueue[T], error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 16 << 20
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	q := &PersistentQueue[T]{
+		mtx:      &sync.Mutex{},
+		dir:      dir,
+		opts:     opts,
+		nextID:   1,
+		inflight: make(map[uint64]pendingItem[T]),
+		signal:   newSignal(),
+		done:     make(chan struct{}),
+	}
+
+	if err := q.replay(); err != nil {
+		return nil, err
+	}
+	if err := q.openActive(); err != nil {
+		return nil, err
+	}
+	q.dropAcked()
+
+	if opts.Sync == SyncInterval {
+		go q.syncLoop()
+	}
+
+	return q, nil
+}
+
+// Enqueue appends the item to the log, waiting for room while the queue is
+// full. It RETURNS ErrClosed once the queue is closed, or the error of ctx
+func (q *PersistentQueue[T]) Enqueue(ctx context.Context, item T) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	for {
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return ErrClosed
+		}
+		if !q.full() {
+			err := q.push(item, data)
+			q.mtx.Unlock()
+			return err
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryEnqueue appends the item to the log without waiting, it RETURNS
+// ErrFull when the queue is full and ErrClosed once the queue is closed
+func (q *PersistentQueue[T]) TryEnqueue(item T) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.full() {
+		return ErrFull
+	}
+
+	return q.push(item, data)
+}
+
+// Receive RETURNS the oldest pending item, waiting for one while the queue
+// is empty. The item is delivered again after a restart until it is
+// acknowledged. Once the queue is closed the pending items are still
+// returned, then ErrClosed
+func (q *PersistentQueue[T]) Receive(ctx context.Context) (*Delivery[T], error) {
+	for {
+		q.mtx.Lock()
+		if q.stopped {
+			q.mtx.Unlock()
+			return nil, ErrClosed
+		}
+		if len(q.pending) > 0 {
+			d := q.deliver()
+			q.mtx.Unlock()
+			return d, nil
+		}
+		if q.closed {
+			q.mtx.Unlock()
+			return nil, ErrClosed
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryReceive RETURNS the oldest pending item without waiting, ok is false
+// when the queue is empty
+func (q *PersistentQueue[T]) TryReceive() (*Delivery[T], bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped || len(q.pending) == 0 {
+		return nil, false
+	}
+
+	return q.deliver(), true
+}
+
+// Dequeue receives the oldest item and acknowledges it at once
+func (q *PersistentQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	d, err := q.Receive(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return d.Item, d.Ack()
+}
+
+// TryDequeue receives the oldest item without waiting and acknowledges it
+// at once, ok is false when the queue is empty or the acknowledgement failed
+func (q *PersistentQueue[T]) TryDequeue() (item T, ok bool) {
+	d, ok := q.TryReceive()
+	if !ok {
+		return item, false
+	}
+
+	if err := d.Ack(); err != nil {
+		return item, false
+	}
+	return d.Item, true
+}
+
+// Close stops the queue from accepting items and wakes up the waiting
+// producers and consumers. The pending items can still be received and
+// acknowledged until the queue is stopped
+func (q *PersistentQueue[T]) Close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.closed = true
+	q.signal.notify()
+}
+
+// Stop closes the queue and its files, the items not acknowledged are
+// delivered again when the queue is reopened
+func (q *PersistentQueue[T]) Stop() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped {
+		return nil
+	}
+
+	q.closed, q.stopped = true, true
+	q.signal.notify()
+	close(q.done)
+
+	err := q.flush(true)
+	if cerr := q.active.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Sync flushes the writes to disk
+func (q *PersistentQueue[T]) Sync() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped {
+		return ErrClosed
+	}
+	return q.flush(true)
+}
+
+// Length returns the number of pending items, the items in flight excluded
+func (q *PersistentQueue[T]) Length() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return len(q.pending)
+}
+
+// InFlight returns the number of items received but not acknowledged
+func (q *PersistentQueue[T]) InFlight() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return len(q.inflight)
+}
+
+// Segments returns the number of segment files
+func (q *PersistentQueue[T]) Segments() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return len(q.segments)
+}
+
+// Compact rewrites the sealed segments holding acknowledged items, keeping
+// only the records still needed to rebuild the queue
+func (q *PersistentQueue[T]) Compact() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped {
+		return ErrClosed
+	}
+
+	q.dropAcked()
+
+	live := make(map[uint64]bool, len(q.pending)+len(q.inflight))
+	for _, p := range q.pending {
+		live[p.id] = true
+	}
+	for id := range q.inflight {
+		live[id] = true
+	}
+
+	for _, seg := range q.segments[:len(q.segments)-1] {
+		// segments without items only hold acknowledgements
+		if seg.live == seg.items && seg.items > 0 {
+			continue
+		}
+		if err := q.rewrite(seg, live); err != nil {
+			return err
+		}
+	}
+
+	q.dropAcked()
+	return nil
+}
+
+func (q *PersistentQueue[T]) full() bool {
+	return q.opts.Capacity > 0 && len(q.pending) >= q.opts.Capacity
+}
+
+func (q *PersistentQueue[T]) push(item T, data []byte) error {
+	if q.stopped {
+		return ErrClosed
+	}
+
+	id := q.nextID
+	if err := q.write(recordItem, id, data); err != nil {
+		return err
+	}
+	q.nextID++
+
+	seg := q.segments[len(q.segments)-1]
+	if seg.items == 0 {
+		seg.first = id
+	}
+	seg.last = id
+	seg.items++
+	seg.live++
+
+	q.pending = append(q.pending, pendingItem[T]{id: id, item: item})
+	q.signal.notify()
+	return nil
+}
+
+func (q *PersistentQueue[T]) deliver() *Delivery[T] {
+	p := q.pending[0]
+	q.pending[0] = pendingItem[T]{}
+	q.pending = q.pending[1:]
+	q.inflight[p.id] = p
+	q.signal.notify()
+
+	return &Delivery[T]{ID: p.id, Item: p.item, q: q}
+}
+
+func (q *PersistentQueue[T]) ack(id uint64) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.stopped {
+		return ErrClosed
+	}
+	if _, ok := q.inflight[id]; !ok {
+		return ErrUnknownDelivery
+	}
+
+	if err := q.write(recordAck, id, nil); err != nil {
+		return err
+	}
+	delete(q.inflight, id)
+
+	if seg := q.segmentOf(id); seg != nil {
+		seg.live--
+	}
+	q.dropAcked()
+	return nil
+}
+
+func (q *PersistentQueue[T]) nack(id uint64) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	p, ok := q.inflight[id]
+	if !ok {
+		return ErrUnknownDelivery
+	}
+
+	delete(q.inflight, id)
+	q.pending = append([]pendingItem[T]{p}, q.pending...)
+	q.signal.notify()
+	return nil
+}
+
+// write appends a record to the active segment, starting a new segment
+// when it is full
+func (q *PersistentQueue[T]) write(typ byte, id uint64, data []byte) error {
+	seg := q.segments[len(q.segments)-1]
+	if seg.size >= q.opts.SegmentSize {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		seg = q.segments[len(q.segments)-1]
+	}
+
+	payload := make([]byte, payloadHeaderSize+len(data))
+	payload[0] = typ
+	binary.BigEndian.PutUint64(payload[1:], id)
+	copy(payload[payloadHeaderSize:], data)
+
+	n, err := writeRecord(q.writer, payload)
+	if err != nil {
+		return err
+	}
+	seg.size += int64(n)
+	q.dirty = true
+
+	return q.flush(q.opts.Sync == SyncAlways)
+}
+
+// flush writes the buffered records to the file, and to the disk with sync
+func (q *PersistentQueue[T]) flush(sync bool) error {
+	if err := q.writer.Flush(); err != nil {
+		return err
+	}
+	if !sync || !q.dirty || q.opts.Sync == SyncNever {
+		return nil
+	}
+
+	q.dirty = false
+	return q.active.Sync()
+}
+
+func (q *PersistentQueue[T]) syncLoop() {
+	ticker := time.NewTicker(q.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.mtx.Lock()
+			if !q.stopped {
+				_ = q.flush(true)
+			}
+			q.mtx.Unlock()
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// roll seals the active segment and starts a new one
+func (q *PersistentQueue[T]) roll() error {
+	if err := q.writer.Flush(); err != nil {
+		return err
+	}
+	if q.opts.Sync != SyncNever {
+		if err := q.active.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := q.active.Close(); err != nil {
+		return err
+	}
+
+	last := q.segments[len(q.segments)-1]
+	q.segments = append(q.segments, q.newSegment(last.seq+1))
+	return q.openActive()
+}
+
+func (q *PersistentQueue[T]) newSegment(seq uint64) *segment {
+	return &segment{seq: seq, path: filepath.Join(q.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentExt))}
+}
+
+// openActive opens the last segment for appending, creating it when needed
+func (q *PersistentQueue[T]) openActive() error {
+	if len(q.segments) == 0 {
+		q.segments = append(q.segments, q.newSegment(1))
+	}
+
+	seg := q.segments[len(q.segments)-1]
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	q.active = f
+	q.writer = bufio.NewWriter(f)
+	return nil
+}
+
+// dropAcked deletes the sealed segments at the head of the log whose items
+// are all acknowledged. Their acknowledgements in later segments are
+// ignored on replay
+func (q *PersistentQueue[T]) dropAcked() {
+	for len(q.segments) > 1 && q.segments[0].live == 0 {
+		if err := os.Remove(q.segments[0].path); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		q.segments = q.segments[1:]
+	}
+}
+
+func (q *PersistentQueue[T]) segmentOf(id uint64) *segment {
+	for _, seg := range q.segments {
+		if seg.items > 0 && seg.first <= id && id <= seg.last {
+			return seg
+		}
+	}
+
+	return nil
+}
+
+// rewrite rewrites a sealed segment keeping the live items and the
+// acknowledgements of the items in the older segments still on disk
+func (q *PersistentQueue[T]) rewrite(seg *segment, live map[uint64]bool) error {
+	tmp := seg.path + ".tmp"
+
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+
+	size, items := int64(0), 0
+	var first, last uint64
+	err = readSegment(seg.path, func(typ byte, id uint64, payload []byte) error {
+		switch typ {
+		case recordItem:
+			if !live[id] {
+				return nil
+			}
+			if items == 0 {
+				first = id
+			}
+			last = id
+			items++
+		case recordAck:
+			if owner := q.segmentOf(id); owner == nil || owner == seg {
+				return nil
+			}
+		}
+
+		n, err := writeRecord(w, payload)
+		size += int64(n)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && q.opts.Sync != SyncNever {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, seg.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	seg.size, seg.items, seg.live = size, items, items
+	if items > 0 {
+		seg.first, seg.last = first, last
+	}
+	return nil
+}
+
+// replay rebuilds the queue from the segment files
+func (q *PersistentQueue[T]) replay() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		var seq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentExt), "%d", &seq); err != nil {
+			continue
+		}
+		q.segments = append(q.segments, q.newSegment(seq))
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+
+	items := make(map[uint64]T)
+	order := make([]uint64, 0)
+	acked := make(map[uint64]bool)
+
+	for i, seg := range q.segments {
+		valid := int64(0)
+		err := readSegment(seg.path, func(typ byte, id uint64, payload []byte) error {
+			valid += int64(recordHeaderSize + len(payload))
+
+			switch typ {
+			case recordItem:
+				var item T
+				if err := json.Unmarshal(payload[payloadHeaderSize:], &item); err != nil {
+					return fmt.Errorf("%s: item %d: %w", seg.path, id, err)
+				}
+				items[id] = item
+				order = append(order, id)
+
+				if seg.items == 0 {
+					seg.first = id
+				}
+				seg.last = id
+				seg.items++
+			case recordAck:
+				acked[id] = true
+			}
+
+			// the acks outlive the segments of their items, an id still
+			// acknowledged on disk must not be given out again
+			if id >= q.nextID {
+				q.nextID = id + 1
+			}
+			return nil
+		})
+
+		var corrupt *corruptError
+		if errors.As(err, &corrupt) && i == len(q.segments)-1 {
+			// a crash in the middle of a write leaves a partial record at
+			// the end of the log, it was never acknowledged to the producer
+			if err := os.Truncate(seg.path, valid); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		seg.size = valid
+	}
+
+	for _, id := range order {
+		if acked[id] {
+			continue
+		}
+		q.pending = append(q.pending, pendingItem[T]{id: id, item: items[id]})
+		if seg := q.segmentOf(id); seg != nil {
+			seg.live++
+		}
+	}
+
+	return nil
+}
+
+type corruptError struct {
+	path   string
+	offset int64
+}
+
+func (e *corruptError) Error() string {
+	return fmt.Sprintf("%s: corrupt record at offset %d", e.path, e.offset)
+}
+
+// readSegment calls fn with every record of the segment file
+func readSegment(path string, fn func(typ byte, id uint64, payload []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	offset := int64(0)
+	for {
+		var header [recordHeaderSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return &corruptError{path: path, offset: offset}
+		}
+
+		// the length is checked against the file before allocating
+		length := binary.BigEndian.Uint32(header[:4])
+		if length < payloadHeaderSize || int64(length) > info.Size()-offset-recordHeaderSize {
+			return &corruptError{path: path, offset: offset}
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return &corruptError{path: path, offset: offset}
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return &corruptError{path: path, offset: offset}
+		}
+
+		if err := fn(payload[0], binary.BigEndian.Uint64(payload[1:payloadHeaderSize]), payload); err != nil {
+			return err
+		}
+		offset += int64(recordHeaderSize) + int64(length)
+	}
+}
+
+func writeRecord(w io.Writer, payload []byte) (int, error) {
+	var header [recordHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return 0, err
+	}
+
+	return recordHeaderSize + len(payload), nil
+}
@@ -0,0 +1,269 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type event struct {
+	ID     int    `json:"id"`
+	Action string `json:"action"`
+}
+
+func openQueue(t testing.TB, dir string, opts PersistentOptions) *PersistentQueue[event] {
+	q, err := OpenPersistent[event](dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestPersistentQueue(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, PersistentOptions{})
+
+	var fifo FIFO[event] = q
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, fifo.Enqueue(context.Background(), event{ID: i, Action: "recheck"}))
+	}
+	assert.Equal(t, 3, fifo.Length())
+
+	item, err := fifo.Dequeue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, event{ID: 1, Action: "recheck"}, item)
+
+	// received but not acknowledged
+	d, ok := q.TryReceive()
+	assert.True(t, ok)
+	assert.Equal(t, 2, d.Item.ID)
+	assert.Equal(t, 1, q.InFlight())
+	assert.NoError(t, q.Stop())
+	assert.Equal(t, ErrClosed, d.Ack())
+
+	// the unacknowledged items are delivered again after a restart
+	q = openQueue(t, dir, PersistentOptions{})
+	assert.Equal(t, 2, q.Length())
+	d, err = q.Receive(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, d.Item.ID)
+
+	// nacked items go back to the head
+	assert.NoError(t, d.Nack())
+	assert.Equal(t, ErrUnknownDelivery, d.Ack())
+	d, _ = q.TryReceive()
+	assert.Equal(t, 2, d.Item.ID)
+	assert.NoError(t, d.Ack())
+
+	assert.NoError(t, q.Enqueue(context.Background(), event{ID: 4}))
+	assert.NoError(t, q.Stop())
+
+	q = openQueue(t, dir, PersistentOptions{})
+	defer q.Stop()
+	for _, expected := range []int{3, 4} {
+		item, ok := q.TryDequeue()
+		assert.True(t, ok)
+		assert.Equal(t, expected, item.ID)
+	}
+	_, ok = q.TryDequeue()
+	assert.False(t, ok)
+
+	// the ids keep growing across restarts
+	assert.NoError(t, q.TryEnqueue(event{ID: 5}))
+	d, _ = q.TryReceive()
+	assert.Equal(t, uint64(5), d.ID)
+}
+
+func TestPersistentQueueSegments(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, PersistentOptions{SegmentSize: 256, Sync: SyncNever})
+
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, q.TryEnqueue(event{ID: i, Action: "notify"}))
+	}
+	segments := q.Segments()
+	assert.Greater(t, segments, 5)
+
+	// acknowledging the head drops the fully acknowledged segments
+	for i := 0; i < 25; i++ {
+		item, ok := q.TryDequeue()
+		assert.True(t, ok)
+		assert.Equal(t, i, item.ID)
+	}
+	assert.Less(t, q.Segments(), segments)
+	assert.Equal(t, q.Segments(), countSegments(t, dir))
+
+	// acknowledge every other item out of order, then compact
+	deliveries := make([]*Delivery[event], 0)
+	for {
+		d, ok := q.TryReceive()
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+	for i, d := range deliveries {
+		if i%2 == 1 {
+			assert.NoError(t, d.Ack())
+		}
+	}
+
+	before := dirSize(t, dir)
+	assert.NoError(t, q.Compact())
+	assert.Less(t, dirSize(t, dir), before)
+	assert.NoError(t, q.Stop())
+
+	q = openQueue(t, dir, PersistentOptions{SegmentSize: 256})
+	defer q.Stop()
+
+	ids := make([]int, 0)
+	for {
+		item, ok := q.TryDequeue()
+		if !ok {
+			break
+		}
+		ids = append(ids, item.ID)
+	}
+
+	expected := make([]int, 0)
+	for i := 25; i < 50; i += 2 {
+		expected = append(expected, i)
+	}
+	assert.Equal(t, expected, ids)
+}
+
+func TestPersistentQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, PersistentOptions{})
+	assert.NoError(t, q.TryEnqueue(event{ID: 1}))
+	assert.NoError(t, q.TryEnqueue(event{ID: 2}))
+	assert.NoError(t, q.Stop())
+
+	// simulate a crash in the middle of the last write
+	path := filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, 1, segmentExt))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-3))
+
+	q = openQueue(t, dir, PersistentOptions{})
+	assert.Equal(t, 1, q.Length())
+	assert.NoError(t, q.TryEnqueue(event{ID: 3}))
+	assert.NoError(t, q.Stop())
+
+	q = openQueue(t, dir, PersistentOptions{})
+	defer q.Stop()
+	assert.Equal(t, 2, q.Length())
+}
+
+func TestPersistentQueueRestartAfterDrop(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, PersistentOptions{SegmentSize: 1})
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, q.TryEnqueue(event{ID: i}))
+	}
+	for i := 1; i <= 3; i++ {
+		_, ok := q.TryDequeue()
+		assert.True(t, ok)
+	}
+	assert.NoError(t, q.Stop())
+
+	// the segments of the acknowledged items are dropped, the ack records
+	// left must not acknowledge the items enqueued after the restart
+	q = openQueue(t, dir, PersistentOptions{SegmentSize: 1})
+	assert.Equal(t, 0, q.Length())
+	for i := 4; i <= 6; i++ {
+		assert.NoError(t, q.TryEnqueue(event{ID: i}))
+	}
+	assert.NoError(t, q.Stop())
+
+	q = openQueue(t, dir, PersistentOptions{SegmentSize: 1})
+	defer q.Stop()
+	assert.Equal(t, 3, q.Length())
+	item, _ := q.TryDequeue()
+	assert.Equal(t, 4, item.ID)
+}
+
+func TestPersistentQueueCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, dir, PersistentOptions{})
+	assert.NoError(t, q.TryEnqueue(event{ID: 1}))
+	assert.NoError(t, q.TryEnqueue(event{ID: 2}))
+	assert.NoError(t, q.Stop())
+
+	// the length of the second record claims more bytes than the file holds
+	path := filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, 1, segmentExt))
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	first := recordHeaderSize + int(binary.BigEndian.Uint32(b[:4]))
+	binary.BigEndian.PutUint32(b[first:], 1<<31)
+	assert.NoError(t, os.WriteFile(path, b, 0644))
+
+	q = openQueue(t, dir, PersistentOptions{})
+	defer q.Stop()
+	assert.Equal(t, 1, q.Length())
+}
+
+func TestPersistentQueueBlocking(t *testing.T) {
+	q := openQueue(t, t.TempDir(), PersistentOptions{Capacity: 1, Sync: SyncInterval, SyncInterval: time.Millisecond})
+	defer q.Stop()
+
+	assert.NoError(t, q.TryEnqueue(event{ID: 1}))
+	assert.Equal(t, ErrFull, q.TryEnqueue(event{ID: 2}))
+
+	done := make(chan error)
+	go func() { done <- q.Enqueue(context.Background(), event{ID: 2}) }()
+
+	time.Sleep(10 * time.Millisecond)
+	item, err := q.Dequeue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.ID)
+	assert.NoError(t, <-done)
+
+	q.Close()
+	assert.Equal(t, ErrClosed, q.TryEnqueue(event{ID: 3}))
+	item, err = q.Dequeue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, item.ID)
+	_, err = q.Dequeue(context.Background())
+	assert.Equal(t, ErrClosed, err)
+}
+
+func countSegments(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	return len(entries)
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+
+	size := int64(0)
+	for _, e := range entries {
+		info, err := e.Info()
+		assert.NoError(t, err)
+		size += info.Size()
+	}
+	return size
+}
+
+func BenchmarkPersistentQueue(b *testing.B) {
+	for _, policy := range []SyncPolicy{SyncNever, SyncInterval} {
+		b.Run(fmt.Sprintf("sync=%d", policy), func(b *testing.B) {
+			q := openQueue(b, b.TempDir(), PersistentOptions{Sync: policy, SegmentSize: 1 << 20})
+			defer q.Stop()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = q.TryEnqueue(event{ID: i, Action: "notify"})
+				q.TryDequeue()
+			}
+		})
+	}
+}
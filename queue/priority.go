@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// PriorityQueue RETURNS the items with the highest priority first, items
+// of equal priority in insertion order. It is safe for concurrent use
+type PriorityQueue[T any] struct {
+	mtx    *sync.Mutex
+	heap   entryHeap[T]
+	closed bool
+	signal signal
+}
+
+func NewPriority[T any]() *PriorityQueue[T] {
+	return &PriorityQueue[T]{mtx: &sync.Mutex{}, signal: newSignal()}
+}
+
+// Enqueue adds the item with priority, it RETURNS ErrClosed once the queue is closed
+func (q *PriorityQueue[T]) Enqueue(item T, priority int) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	// the heap is a min heap
+	q.heap.push(item, -int64(priority))
+	q.signal.notify()
+	return nil
+}
+
+// Dequeue removes the item with the highest priority and RETURNS it,
+// waiting for one while the queue is empty. Once the queue is closed the
+// remaining items are still returned, then ErrClosed
+func (q *PriorityQueue[T]) Dequeue(ctx context.Context) (T, error) {
+	for {
+		q.mtx.Lock()
+		if q.heap.len() > 0 {
+			item := q.heap.pop().item
+			q.mtx.Unlock()
+			return item, nil
+		}
+		if q.closed {
+			q.mtx.Unlock()
+			var zero T
+			return zero, ErrClosed
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// TryDequeue removes the item with the highest priority and RETURNS it, ok
+// is false when the queue is empty
+func (q *PriorityQueue[T]) TryDequeue() (item T, ok bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.heap.len() == 0 {
+		return item, false
+	}
+
+	return q.heap.pop().item, true
+}
+
+// Peek RETURNS the item with the highest priority without removing it
+func (q *PriorityQueue[T]) Peek() (item T, priority int, ok bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.heap.len() == 0 {
+		return item, 0, false
+	}
+
+	e := q.heap.peek()
+	return e.item, int(-e.rank), true
+}
+
+// Close stops the queue from accepting items and wakes up the waiting consumers
+func (q *PriorityQueue[T]) Close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.closed = true
+	q.signal.notify()
+}
+
+// Items returns a copy of the queue items in dequeue order
+func (q *PriorityQueue[T]) Items() []T {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.heap.items()
+}
+
+// Length returns the queue length
+func (q *PriorityQueue[T]) Length() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.heap.len()
+}
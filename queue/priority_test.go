@@ -0,0 +1,310 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manualClock only moves forward when advanced
+type manualClock struct {
+	mtx     sync.Mutex
+	now     time.Time
+	waiters []*manualWaiter
+}
+
+type manualWaiter struct {
+	clock *manualClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+func (w *manualWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop removes the waiter from the clock
+func (w *manualWaiter) Stop() bool {
+	w.clock.mtx.Lock()
+	defer w.clock.mtx.Unlock()
+
+	for i, other := range w.clock.waiters {
+		if other == w {
+			w.clock.waiters = append(w.clock.waiters[:i], w.clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	w := &manualWaiter{clock: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriority[string]()
+	_ = q.Enqueue("low", 1)
+	_ = q.Enqueue("high-1", 10)
+	_ = q.Enqueue("mid", 5)
+	_ = q.Enqueue("high-2", 10)
+	_ = q.Enqueue("negative", -3)
+	_ = q.Enqueue("high-3", 10)
+
+	item, priority, ok := q.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "high-1", item)
+	assert.Equal(t, 10, priority)
+
+	// equal priorities come out in insertion order
+	expected := []string{"high-1", "high-2", "high-3", "mid", "low", "negative"}
+	assert.Equal(t, expected, q.Items())
+	assert.Equal(t, 6, q.Length())
+
+	for _, e := range expected {
+		item, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, e, item)
+	}
+
+	_, ok = q.TryDequeue()
+	assert.False(t, ok)
+
+	done := make(chan string)
+	go func() {
+		item, _ := q.Dequeue(context.Background())
+		done <- item
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_ = q.Enqueue("late", 0)
+	assert.Equal(t, "late", <-done)
+
+	q.Close()
+	assert.Equal(t, ErrClosed, q.Enqueue("x", 1))
+	_, err := q.Dequeue(context.Background())
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestPriorityQueueStable(t *testing.T) {
+	q := NewPriority[int]()
+
+	r := rand.New(rand.NewSource(1))
+	type item struct{ priority, seq int }
+	items := make([]item, 1000)
+	for i := range items {
+		items[i] = item{priority: r.Intn(10), seq: i}
+		_ = q.Enqueue(i, items[i].priority)
+	}
+
+	prev := item{priority: 10, seq: -1}
+	for range items {
+		i, _ := q.TryDequeue()
+		cur := items[i]
+		assert.True(t, cur.priority < prev.priority || (cur.priority == prev.priority && cur.seq > prev.seq))
+		prev = cur
+	}
+}
+
+func TestDelayQueue(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	q := NewDelay[string](clock)
+
+	_ = q.ScheduleAfter("recheck", 10*time.Minute)
+	_ = q.ScheduleAfter("expire", time.Hour)
+	_ = q.ScheduleAfter("first", 10*time.Minute)
+	_ = q.Schedule("now", clock.Now())
+
+	assert.Equal(t, []string{"now", "recheck", "first", "expire"}, q.Items())
+
+	item, ok := q.TryDequeue()
+	assert.True(t, ok)
+	assert.Equal(t, "now", item)
+	_, ok = q.TryDequeue()
+	assert.False(t, ok)
+
+	next, ok := q.Next()
+	assert.True(t, ok)
+	assert.Equal(t, clock.Now().Add(10*time.Minute), next.UTC())
+
+	released := make(chan string, 4)
+	go func() {
+		for {
+			item, err := q.Dequeue(context.Background())
+			if err != nil {
+				close(released)
+				return
+			}
+			released <- item
+		}
+	}()
+
+	waitForWaiters(clock)
+	select {
+	case item := <-released:
+		t.Fatalf("%s released before its time", item)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(10 * time.Minute)
+	assert.Equal(t, "recheck", <-released)
+	assert.Equal(t, "first", <-released)
+
+	waitForWaiters(clock)
+	clock.Advance(time.Hour)
+	assert.Equal(t, "expire", <-released)
+
+	q.Close()
+	_, open := <-released
+	assert.False(t, open)
+	assert.Equal(t, ErrClosed, q.ScheduleAfter("x", 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewDelay[int](nil).Dequeue(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+// waitForWaiters waits until a consumer waits on the clock
+func waitForWaiters(c *manualClock) {
+	for {
+		c.mtx.Lock()
+		n := len(c.waiters)
+		c.mtx.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDelayQueueTimeRange(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	q := NewDelay[string](clock)
+
+	// a zero time means now, times out of the nanosecond range keep their order
+	_ = q.ScheduleAfter("later", time.Minute)
+	_ = q.Schedule("far", time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	_ = q.Schedule("now", time.Time{})
+	_ = q.Schedule("past", time.Date(2, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, []string{"past", "now", "later", "far"}, q.Items())
+
+	for _, expected := range []string{"past", "now"} {
+		item, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, item)
+	}
+	_, ok := q.TryDequeue()
+	assert.False(t, ok)
+}
+
+func TestDelayQueueStopsTimers(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	q := NewDelay[int](clock)
+	_ = q.ScheduleAfter(1, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := q.Dequeue(ctx)
+		done <- err
+	}()
+
+	// every schedule wakes the consumer up, the timers it gives up are stopped
+	for i := 0; i < 10; i++ {
+		waitForWaiters(clock)
+		_ = q.ScheduleAfter(i, time.Hour)
+	}
+	time.Sleep(10 * time.Millisecond)
+	clock.mtx.Lock()
+	assert.Equal(t, 1, len(clock.waiters))
+	clock.mtx.Unlock()
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	clock.mtx.Lock()
+	assert.Equal(t, 0, len(clock.waiters))
+	clock.mtx.Unlock()
+}
+
+func TestDelayQueueSystemClock(t *testing.T) {
+	q := NewDelay[int](nil)
+	_ = q.ScheduleAfter(2, 20*time.Millisecond)
+	_ = q.ScheduleAfter(1, 10*time.Millisecond)
+
+	start := time.Now()
+	for _, expected := range []int{1, 2} {
+		item, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, item)
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(20*time.Millisecond))
+}
+
+func BenchmarkPriorityQueue(b *testing.B) {
+	q := NewPriority[int]()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		_ = q.Enqueue(i, r.Intn(100))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = q.Enqueue(i, r.Intn(100))
+		q.TryDequeue()
+	}
+}
+
+func BenchmarkDelayQueue(b *testing.B) {
+	clock := &manualClock{now: time.Now()}
+	q := NewDelay[int](clock)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		_ = q.ScheduleAfter(i, time.Duration(r.Intn(1000))*time.Second)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = q.ScheduleAfter(i, time.Duration(r.Intn(1000))*time.Second)
+		clock.Advance(time.Second)
+		q.TryDequeue()
+	}
+}
+
+func BenchmarkQueue(b *testing.B) {
+	q := New[int]()
+	for i := 0; i < b.N; i++ {
+		_ = q.TryEnqueue(i)
+		q.TryDequeue()
+	}
+}
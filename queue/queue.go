@@ -1,51 +1,204 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"sync"
 )
 
-// queue struct definition
-type queue struct {
-	mtx   *sync.Mutex
-	items []interface{}
+var (
+	// ErrClosed is returned when enqueueing into a closed queue, or when
+	// dequeueing from a closed queue that has been drained
+	ErrClosed = errors.New("queue closed")
+	// ErrFull is returned by TryEnqueue when the queue is at capacity
+	ErrFull = errors.New("queue full")
+)
+
+// FIFO is implemented by the first in first out queues of the package, in
+// memory and persistent
+type FIFO[T any] interface {
+	Enqueue(ctx context.Context, item T) error
+	TryEnqueue(item T) error
+	Dequeue(ctx context.Context) (T, error)
+	TryDequeue() (T, bool)
+	Close()
+	Length() int
+}
+
+var _ FIFO[int] = (*Queue[int])(nil)
+
+// Queue is a FIFO queue safe for concurrent use. A bounded queue blocks
+// the producers while it is full
+type Queue[T any] struct {
+	mtx      *sync.Mutex
+	items    []T
+	capacity int // 0 means unbounded
+	closed   bool
+	signal   signal
+}
+
+// New RETURNS an unbounded queue
+func New[T any]() *Queue[T] {
+	return NewBounded[T](0)
 }
 
-func New() *queue {
-	return &queue{
-		mtx:   &sync.Mutex{},
-		items: make([]interface{}, 0),
+// NewBounded RETURNS a queue holding at most capacity items, a capacity of
+// zero means unbounded
+func NewBounded[T any](capacity int) *Queue[T] {
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	return &Queue[T]{
+		mtx:      &sync.Mutex{},
+		items:    make([]T, 0),
+		capacity: capacity,
+		signal:   newSignal(),
+	}
+}
+
+// Enqueue adds the item into the queue, waiting for room while the queue is
+// full. It RETURNS ErrClosed once the queue is closed, or the error of ctx
+func (q *Queue[T]) Enqueue(ctx context.Context, item T) error {
+	for {
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return ErrClosed
+		}
+		if !q.full() {
+			q.push(item)
+			q.mtx.Unlock()
+			return nil
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
-// Enqueue adds the item into the queue
-func (q *queue) Enqueue(item interface{}) {
+// TryEnqueue adds the item into the queue without waiting, it RETURNS ErrFull
+// when the queue is full and ErrClosed once the queue is closed
+func (q *Queue[T]) TryEnqueue(item T) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
-	q.items = append(q.items, item)
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.full() {
+		return ErrFull
+	}
+
+	q.push(item)
+	return nil
 }
 
-// Dequeue removes the item from the queue and RETURNS item
-func (q *queue) Dequeue() interface{} {
+// Dequeue removes the item from the queue and RETURNS item, waiting for one
+// while the queue is empty. Once the queue is closed the remaining items are
+// still returned, then ErrClosed
+func (q *Queue[T]) Dequeue(ctx context.Context) (T, error) {
+	for {
+		q.mtx.Lock()
+		if len(q.items) > 0 {
+			item := q.pop()
+			q.mtx.Unlock()
+			return item, nil
+		}
+		if q.closed {
+			q.mtx.Unlock()
+			var zero T
+			return zero, ErrClosed
+		}
+		changed := q.signal.wait()
+		q.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// TryDequeue removes the item from the queue and RETURNS item, ok is false
+// when the queue is empty
+func (q *Queue[T]) TryDequeue() (item T, ok bool) {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
-	item := q.items[0]
-	q.items = q.items[1:]
-	return item
+	if len(q.items) == 0 {
+		return item, false
+	}
+
+	return q.pop(), true
+}
+
+// Close stops the queue from accepting items and wakes up the waiting
+// producers and consumers. Closing twice is a no-op
+func (q *Queue[T]) Close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		q.signal.notify()
+	}
 }
 
-// Items returns the queue items
-func (q *queue) Items() []interface{} {
+// Closed reports whether the queue was closed
+func (q *Queue[T]) Closed() bool {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
-	return q.items
+	return q.closed
+}
+
+// Items returns a copy of the queue items, oldest first
+func (q *Queue[T]) Items() []T {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	items := make([]T, len(q.items))
+	copy(items, q.items)
+	return items
 }
 
 // Length returns the queue length
-func (q *queue) Length() int {
+func (q *Queue[T]) Length() int {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
 	return len(q.items)
 }
+
+// Capacity returns the queue capacity, 0 for an unbounded queue
+func (q *Queue[T]) Capacity() int {
+	return q.capacity
+}
+
+func (q *Queue[T]) full() bool {
+	return q.capacity > 0 && len(q.items) >= q.capacity
+}
+
+func (q *Queue[T]) push(item T) {
+	q.items = append(q.items, item)
+	q.signal.notify()
+}
+
+func (q *Queue[T]) pop() T {
+	var zero T
+	item := q.items[0]
+	// release the reference held by the backing array
+	q.items[0] = zero
+	q.items = q.items[1:]
+	q.signal.notify()
+
+	return item
+}
@@ -1,8 +1,12 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -30,15 +34,19 @@ func TestQueue(t *testing.T) {
 			actions:  []action{{Name: "E", Value: "OK"}, {Name: "E", Value: 2}, {Name: "D", Value: 2}},
 			expected: []interface{}{2},
 		},
+		{
+			actions:  []action{{Name: "D"}, {Name: "E", Value: 3}},
+			expected: []interface{}{3},
+		},
 	}
 
 	for i, tt := range testcases {
-		queue := New()
+		queue := New[interface{}]()
 		for _, action := range tt.actions {
 			if action.Name == "E" {
-				queue.Enqueue(action.Value)
+				assert.NoError(t, queue.Enqueue(context.Background(), action.Value))
 			} else {
-				queue.Dequeue()
+				queue.TryDequeue()
 			}
 		}
 
@@ -46,3 +54,123 @@ func TestQueue(t *testing.T) {
 		assert.Equal(t, len(tt.expected), queue.Length())
 	}
 }
+
+func TestItemsIsACopy(t *testing.T) {
+	q := New[int]()
+	_ = q.TryEnqueue(1)
+
+	items := q.Items()
+	items[0] = 42
+
+	item, ok := q.TryDequeue()
+	assert.True(t, ok)
+	assert.Equal(t, 1, item)
+
+	_, ok = q.TryDequeue()
+	assert.False(t, ok)
+}
+
+func TestBlockingDequeue(t *testing.T) {
+	q := New[string]()
+
+	done := make(chan string)
+	go func() {
+		item, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		done <- item
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, q.Enqueue(context.Background(), "a"))
+	assert.Equal(t, "a", <-done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := q.Dequeue(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestCapacity(t *testing.T) {
+	q := NewBounded[int](2)
+	assert.Equal(t, 2, q.Capacity())
+
+	assert.NoError(t, q.TryEnqueue(1))
+	assert.NoError(t, q.TryEnqueue(2))
+	assert.Equal(t, ErrFull, q.TryEnqueue(3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(q.Enqueue(ctx, 3), context.DeadlineExceeded))
+
+	// the blocked producer resumes once an item is dequeued
+	done := make(chan error)
+	go func() { done <- q.Enqueue(context.Background(), 3) }()
+
+	time.Sleep(10 * time.Millisecond)
+	item, _ := q.TryDequeue()
+	assert.Equal(t, 1, item)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int{2, 3}, q.Items())
+}
+
+func TestClose(t *testing.T) {
+	q := NewBounded[int](1)
+	_ = q.TryEnqueue(1)
+
+	blocked := make(chan error)
+	go func() { blocked <- q.Enqueue(context.Background(), 2) }()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	q.Close()
+	assert.True(t, q.Closed())
+	assert.Equal(t, ErrClosed, <-blocked)
+	assert.Equal(t, ErrClosed, q.TryEnqueue(3))
+
+	// the remaining items are drained before ErrClosed
+	item, err := q.Dequeue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item)
+	_, err = q.Dequeue(context.Background())
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestConcurrentProducersConsumers(t *testing.T) {
+	q := NewBounded[int](8)
+
+	const producers, perProducer = 8, 500
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				assert.NoError(t, q.Enqueue(context.Background(), p*perProducer+i))
+			}
+		}(p)
+	}
+
+	var mtx sync.Mutex
+	seen := make(map[int]bool)
+	var consumers sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				item, err := q.Dequeue(context.Background())
+				if err != nil {
+					return
+				}
+				mtx.Lock()
+				seen[item] = true
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	q.Close()
+	consumers.Wait()
+	assert.Len(t, seen, producers*perProducer)
+}
@@ -0,0 +1,30 @@
+package queue
+
+// signal wakes up the goroutines waiting for a change of a queue. It is
+// guarded by the mutex of the queue
+type signal struct {
+	// closed and replaced on the changes following a wait, waiters block on it
+	changed chan struct{}
+	waiting bool
+}
+
+func newSignal() signal {
+	return signal{changed: make(chan struct{})}
+}
+
+// wait RETURNS the channel closed on the next change
+func (s *signal) wait() chan struct{} {
+	s.waiting = true
+	return s.changed
+}
+
+// notify wakes up the waiters
+func (s *signal) notify() {
+	if !s.waiting {
+		return
+	}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.waiting = false
+}
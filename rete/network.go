@@ -0,0 +1,306 @@
+package rete
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+type nodeKind int
+
+const (
+	leafNode nodeKind = iota // condition evaluated by the evaluator
+	andNode
+	orNode
+)
+
+// truth value of a node for one input
+type value int8
+
+const (
+	unknown value = iota
+	valTrue
+	valFalse
+	invalid // not a boolean (error, number, ...)
+)
+
+type node struct {
+	id       int
+	kind     nodeKind
+	key      string
+	expr     parser.Expression
+	children []*node
+
+	// rule evaluating the condition, its functions and limits are the ones
+	// of every rule sharing the node
+	rule *evaluator.Rule
+
+	// rules having this node as a top-level (alpha) condition
+	rules []int
+}
+
+// Network is a discrimination network compiled from a rule set. Identical
+// conditions are compiled into a single node shared by every rule using them,
+// as long as the rules come from the same engine with the same limits
+type Network struct {
+	rules  []*evaluator.Rule
+	nodes  []*node
+	byKey  map[string]*node
+	alphas []*node // ordered by fan-out, most shared first
+}
+
+// Stats describes the shape of the compiled network
+type Stats struct {
+	Rules       int
+	Nodes       int
+	AlphaNodes  int
+	SharedNodes int // alpha nodes used by more than one rule
+}
+
+// Compile builds the network for the rules in rs
+func Compile(rs *evaluator.RuleSet) *Network {
+	n := &Network{
+		rules: rs.Rules(),
+		byKey: make(map[string]*node),
+	}
+
+	// rules evaluated alike, the conditions are only shared within a class
+	classes := make([]*evaluator.Rule, 0, 1)
+
+	for i, r := range n.rules {
+		var root parser.Expression
+		if stmt, ok := r.AST().Statement.(*parser.ExpressionStatement); ok {
+			root = stmt.Expression
+		}
+
+		class := len(classes)
+		for c, other := range classes {
+			if other.Engine() == r.Engine() && other.Limits() == r.Limits() {
+				class = c
+				break
+			}
+		}
+		if class == len(classes) {
+			classes = append(classes, r)
+		}
+
+		prefix := ""
+		if class > 0 {
+			prefix = fmt.Sprintf("%d|", class)
+		}
+
+		for _, cond := range conjuncts(root) {
+			a := n.compile(cond, r, prefix)
+			if len(a.rules) == 0 || a.rules[len(a.rules)-1] != i {
+				a.rules = append(a.rules, i)
+			}
+		}
+	}
+
+	for _, nd := range n.nodes {
+		if len(nd.rules) > 0 {
+			n.alphas = append(n.alphas, nd)
+		}
+	}
+
+	sort.SliceStable(n.alphas, func(i, j int) bool {
+		return len(n.alphas[i].rules) > len(n.alphas[j].rules)
+	})
+
+	return n
+}
+
+// Eval evaluates the network against params and RETURNS the matching rules
+// in rule set order. A rule is matched when all of its alpha conditions are
+// true; once a shared condition fails no rule depending on it is evaluated
+func (n *Network) Eval(params map[string]interface{}) []*evaluator.Rule {
+	env := evaluator.NewEnvironment(params)
+	memo := make([]value, len(n.nodes))
+	failed := make([]bool, len(n.rules))
+
+	for _, a := range n.alphas {
+		live := false
+		for _, ri := range a.rules {
+			if !failed[ri] {
+				live = true
+				break
+			}
+		}
+
+		if !live {
+			continue
+		}
+
+		if n.eval(a, env, memo) != valTrue {
+			for _, ri := range a.rules {
+				failed[ri] = true
+			}
+		}
+	}
+
+	matched := make([]*evaluator.Rule, 0)
+	for i, r := range n.rules {
+		if !failed[i] {
+			matched = append(matched, r)
+		}
+	}
+
+	return matched
+}
+
+// Stats returns the node counts of the network
+func (n *Network) Stats() Stats {
+	st := Stats{Rules: len(n.rules), Nodes: len(n.nodes), AlphaNodes: len(n.alphas)}
+	for _, a := range n.alphas {
+		if len(a.rules) > 1 {
+			st.SharedNodes++
+		}
+	}
+
+	return st
+}
+
+func (n *Network) eval(nd *node, env *evaluator.Environment, memo []value) value {
+	if v := memo[nd.id]; v != unknown {
+		return v
+	}
+
+	var v value
+	switch nd.kind {
+	case leafNode:
+		v = invalid
+		if nd.expr != nil {
+			if res, ok := nd.rule.EvalNode(nd.expr, env).(*evaluator.Boolean); ok {
+				v = fromBool(res.Value)
+			}
+		}
+
+	// the evaluator does not short-circuit, so an invalid operand makes the
+	// whole expression invalid even when the result is already known
+	case andNode:
+		v = valTrue
+		for _, c := range nd.children {
+			switch n.eval(c, env, memo) {
+			case invalid:
+				v = invalid
+			case valFalse:
+				if v != invalid {
+					v = valFalse
+				}
+			}
+		}
+
+	case orNode:
+		v = valFalse
+		for _, c := range nd.children {
+			switch n.eval(c, env, memo) {
+			case invalid:
+				v = invalid
+			case valTrue:
+				if v != invalid {
+					v = valTrue
+				}
+			}
+		}
+	}
+
+	memo[nd.id] = v
+	return v
+}
+
+func (n *Network) compile(expr parser.Expression, r *evaluator.Rule, prefix string) *node {
+	k := prefix + key(expr)
+	if nd, ok := n.byKey[k]; ok {
+		return nd
+	}
+
+	nd := &node{kind: leafNode, key: k, expr: expr, rule: r}
+	switch op := logicalOperator(expr); op {
+	case "and", "or":
+		nd.kind = andNode
+		if op == "or" {
+			nd.kind = orNode
+		}
+
+		for _, c := range flatten(expr, op) {
+			nd.children = append(nd.children, n.compile(c, r, prefix))
+		}
+	}
+
+	nd.id = len(n.nodes)
+	n.nodes = append(n.nodes, nd)
+	n.byKey[k] = nd
+
+	return nd
+}
+
+// conjuncts splits the top-level AND chain of expr
+func conjuncts(expr parser.Expression) []parser.Expression {
+	if logicalOperator(expr) != "and" {
+		return []parser.Expression{expr}
+	}
+
+	return flatten(expr, "and")
+}
+
+func flatten(expr parser.Expression, op string) []parser.Expression {
+	if logicalOperator(expr) != op {
+		return []parser.Expression{expr}
+	}
+
+	in := expr.(*parser.InfixExpression)
+	return append(flatten(in.Left, op), flatten(in.Right, op)...)
+}
+
+func logicalOperator(expr parser.Expression) string {
+	in, ok := expr.(*parser.InfixExpression)
+	if !ok {
+		return ""
+	}
+
+	return strings.ToLower(in.Operator)
+}
+
+// key RETURNS an unambiguous representation of expr used to detect shared
+// conditions; String() can't be used as it renders regexes like strings
+func key(expr parser.Expression) string {
+	switch e := expr.(type) {
+	case nil:
+		return "<nil>"
+	case *parser.Identifier:
+		return e.Value
+	case *parser.ListName:
+		return "@" + e.Value
+	case *parser.Regex:
+		return fmt.Sprintf("r%q", e.Value)
+	case *parser.StringLiteral:
+		return fmt.Sprintf("%q", e.Value)
+	case *parser.NumberLiteral:
+		return fmt.Sprintf("%v", e.Value)
+	case *parser.BooleanLiteral:
+		return fmt.Sprintf("%t", e.Value)
+	case *parser.PrefixExpression:
+		return "(" + e.Operator + key(e.Right) + ")"
+	case *parser.InfixExpression:
+		return "(" + key(e.Left) + " " + strings.ToLower(e.Operator) + " " + key(e.Right) + ")"
+	case *parser.CallExpression:
+		args := make([]string, 0, len(e.Arguments))
+		for _, a := range e.Arguments {
+			args = append(args, key(a))
+		}
+		return e.Function.String() + "(" + strings.Join(args, ", ") + ")"
+	default:
+		return fmt.Sprintf("%T(%s)", e, e.String())
+	}
+}
+
+func fromBool(b bool) value {
+	if b {
+		return valTrue
+	}
+
+	return valFalse
+}
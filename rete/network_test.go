@@ -0,0 +1,134 @@
+package rete
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+func newRuleSet(t testing.TB, expressions ...string) *evaluator.RuleSet {
+	rs := evaluator.NewRuleSet()
+	for _, expr := range expressions {
+		r, err := evaluator.NewRule(expr, map[string]interface{}{"expr": expr})
+		if err != nil {
+			t.Fatalf("could not compile %q: %s", expr, err)
+		}
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+func expressions(rules []*evaluator.Rule) []string {
+	exprs := make([]string, 0, len(rules))
+	for _, r := range rules {
+		exprs = append(exprs, r.Expression())
+	}
+
+	return exprs
+}
+
+func TestNetworkMatchesRuleSet(t *testing.T) {
+	rs := newRuleSet(t,
+		`country == "DE" AND amount > 100`,
+		`country == "DE" AND amount > 100 AND tier == "gold"`,
+		`country == "DE" and (tier == "gold" OR tier == "silver")`,
+		`country == "AT" OR amount > 1000`,
+		`(tier == "gold" OR tier == "silver") AND amount < 50`,
+		`email contains r"@example\.com$"`,
+		`email contains "@example.com"`,
+		`missing == 1 OR country == "DE"`,
+		`amount + 1`,
+		`true`,
+	)
+
+	inputs := []map[string]interface{}{
+		{"country": "DE", "amount": 150, "tier": "gold", "email": "a@example.com", "missing": 1},
+		{"country": "DE", "amount": 20, "tier": "silver", "email": "a@example.org", "missing": 2},
+		{"country": "AT", "amount": 2000, "tier": "bronze", "email": "b@example.com", "missing": 1},
+		{"country": "FR", "amount": 10, "tier": "gold", "email": "@example.com", "missing": 1},
+	}
+
+	n := Compile(rs)
+	for i, in := range inputs {
+		assert.Equal(t, expressions(rs.Eval(in)), expressions(n.Eval(in)), fmt.Sprintf("inputs[%d]", i))
+	}
+}
+
+func TestNetworkSharesConditions(t *testing.T) {
+	n := Compile(newRuleSet(t,
+		`country == "DE" AND amount > 100`,
+		`country == "DE" AND amount > 200`,
+		`country == "DE" AND (tier == "gold" OR tier == "silver")`,
+		`country == "AT" AND (tier == "gold" OR tier == "silver")`,
+		`email contains "x"`,
+		`email contains r"x"`,
+	))
+
+	st := n.Stats()
+	assert.Equal(t, 6, st.Rules)
+	assert.Equal(t, 7, st.AlphaNodes)
+	assert.Equal(t, 2, st.SharedNodes)
+	// alpha nodes plus the two OR operands
+	assert.Equal(t, 9, st.Nodes)
+}
+
+func TestNetworkEngineFunctions(t *testing.T) {
+	en := evaluator.NewEngine()
+	assert.NoError(t, en.Register("double", func(args []evaluator.Object) (evaluator.Object, error) {
+		return &evaluator.Number{Value: 2 * args[0].(*evaluator.Number).Value}, nil
+	}))
+
+	withEngine, err := en.NewRule(`double(amount) > 100`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	without, err := evaluator.NewRule(`double(amount) > 100`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the rules are evaluated differently, the condition is not shared
+	rs := evaluator.NewRuleSet(withEngine, without)
+	n := Compile(rs)
+	assert.Equal(t, 0, n.Stats().SharedNodes)
+
+	params := map[string]interface{}{"amount": 60}
+	assert.Equal(t, []*evaluator.Rule{withEngine}, rs.Eval(params))
+	assert.Equal(t, rs.Eval(params), n.Eval(params))
+}
+
+func generateRules(b *testing.B, count int) *evaluator.RuleSet {
+	rs := evaluator.NewRuleSet()
+	for i := 0; i < count; i++ {
+		expr := fmt.Sprintf(`country == "C%d" AND tier == "T%d" AND amount > %d`, i%20, i%5, i%100)
+		r, err := evaluator.NewRule(expr, map[string]interface{}{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		rs.Add(r)
+	}
+
+	return rs
+}
+
+var benchInput = map[string]interface{}{"country": "C3", "tier": "T3", "amount": 50}
+
+func BenchmarkRuleSet1000(b *testing.B) {
+	rs := generateRules(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs.Eval(benchInput)
+	}
+}
+
+func BenchmarkNetwork1000(b *testing.B) {
+	n := Compile(generateRules(b, 1000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.Eval(benchInput)
+	}
+}
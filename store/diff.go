@@ -0,0 +1,83 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/zain-bahsarat/rule_egine/parser"
+)
+
+// Diff RETURNS a token level diff of two expressions in wdiff format:
+// removed tokens are wrapped in [- -] and added tokens in {+ +}
+func Diff(from, to string) string {
+	a, b := tokens(from), tokens(to)
+
+	// longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	out := make([]string, 0)
+	removed, added := make([]string, 0), make([]string, 0)
+	flush := func() {
+		if len(removed) > 0 {
+			out = append(out, "[-"+strings.Join(removed, " ")+"-]")
+			removed = removed[:0]
+		}
+		if len(added) > 0 {
+			out = append(out, "{+"+strings.Join(added, " ")+"+}")
+			added = added[:0]
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			out = append(out, a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			added = append(added, b[j])
+			j++
+		default:
+			removed = append(removed, a[i])
+			i++
+		}
+	}
+	flush()
+
+	return strings.Join(out, " ")
+}
+
+func tokens(expression string) []string {
+	l := parser.NewLexer(expression)
+
+	toks := make([]string, 0)
+	for tok := l.NextToken(); tok.Type != parser.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case parser.STRING:
+			toks = append(toks, `"`+tok.Literal+`"`)
+		case parser.REGEX:
+			toks = append(toks, `r"`+tok.Literal+`"`)
+		case parser.LISTNAME:
+			toks = append(toks, "@"+tok.Literal)
+		default:
+			toks = append(toks, tok.Literal)
+		}
+	}
+
+	return toks
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps the history of every rule in a JSON file named after
+// the rule id inside a directory
+type FileStore struct {
+	dir string
+	mtx *sync.RWMutex
+
+	// Now returns the time recorded on new revisions
+	Now func() time.Time
+}
+
+// NewFileStore creates the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir, mtx: &sync.RWMutex{}, Now: time.Now}, nil
+}
+
+func (s *FileStore) Save(id, expression, author string) (Revision, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	history, err := s.read(id)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev, err := next(history, id, expression, author, s.Now())
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return rev, s.write(id, append(history, rev))
+}
+
+func (s *FileStore) Get(id string, version int) (Revision, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	history, err := s.read(id)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return find(history, id, version)
+}
+
+func (s *FileStore) History(id string) ([]Revision, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	history, err := s.read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := find(history, id, 0); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (s *FileStore) Rollback(id string, version int, author string) (Revision, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	history, err := s.read(id)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev, err := rollback(history, id, version, author, s.Now())
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return rev, s.write(id, append(history, rev))
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid rule id: %q", id)
+	}
+
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// read RETURNS the history of the rule, empty when the rule is unknown
+func (s *FileStore) read(id string) ([]Revision, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Revision{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]Revision, 0)
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("corrupted history %s: %w", path, err)
+	}
+
+	return history, nil
+}
+
+// write replaces the history file atomically
+func (s *FileStore) write(id string, history []Revision) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the revisions in memory
+type MemoryStore struct {
+	mtx       *sync.RWMutex
+	revisions map[string][]Revision
+
+	// Now returns the time recorded on new revisions
+	Now func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mtx:       &sync.RWMutex{},
+		revisions: make(map[string][]Revision),
+		Now:       time.Now,
+	}
+}
+
+func (s *MemoryStore) Save(id, expression, author string) (Revision, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	rev, err := next(s.revisions[id], id, expression, author, s.Now())
+	if err != nil {
+		return Revision{}, err
+	}
+
+	s.revisions[id] = append(s.revisions[id], rev)
+	return rev, nil
+}
+
+func (s *MemoryStore) Get(id string, version int) (Revision, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return find(s.revisions[id], id, version)
+}
+
+func (s *MemoryStore) History(id string) ([]Revision, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if _, err := find(s.revisions[id], id, 0); err != nil {
+		return nil, err
+	}
+
+	history := make([]Revision, len(s.revisions[id]))
+	copy(history, s.revisions[id])
+	return history, nil
+}
+
+func (s *MemoryStore) Rollback(id string, version int, author string) (Revision, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	rev, err := rollback(s.revisions[id], id, version, author, s.Now())
+	if err != nil {
+		return Revision{}, err
+	}
+
+	s.revisions[id] = append(s.revisions[id], rev)
+	return rev, nil
+}
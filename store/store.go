@@ -0,0 +1,157 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zain-bahsarat/rule_egine/evaluator"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrUnchanged = errors.New("expression unchanged")
+)
+
+// Revision is one version of a rule expression
+type Revision struct {
+	RuleID     string    `json:"rule_id"`
+	Version    int       `json:"version"` // starts at 1
+	Expression string    `json:"expression"`
+	Previous   string    `json:"previous,omitempty"`
+	Diff       string    `json:"diff,omitempty"`
+	Author     string    `json:"author"`
+	Time       time.Time `json:"time"`
+	// version restored by this revision, 0 when it isn't a rollback
+	RollbackOf int `json:"rollback_of,omitempty"`
+}
+
+// Store keeps the revision history of rules. Revisions are never modified,
+// a rollback records a new revision restoring an old expression
+type Store interface {
+	// Save records a new revision of the rule, the expression must compile
+	Save(id, expression, author string) (Revision, error)
+	// Get returns a revision of the rule, version 0 is the latest
+	Get(id string, version int) (Revision, error)
+	// History returns every revision of the rule, oldest first
+	History(id string) ([]Revision, error)
+	// Rollback records a new revision restoring the expression of version
+	Rollback(id string, version int, author string) (Revision, error)
+}
+
+// Compile compiles a pinned version of the rule, version 0 is the latest
+func Compile(s Store, id string, version int) (*evaluator.Rule, error) {
+	rev, err := s.Get(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluator.NewRule(rev.Expression, map[string]interface{}{
+		"id":      rev.RuleID,
+		"version": rev.Version,
+	})
+}
+
+// Comparison is the result of evaluating two versions of a rule on the same input
+type Comparison struct {
+	A, B             Revision
+	ResultA, ResultB bool
+}
+
+func (c Comparison) Agree() bool {
+	return c.ResultA == c.ResultB
+}
+
+// Compare evaluates two versions of the rule side by side
+func Compare(s Store, id string, a, b int, params map[string]interface{}) (Comparison, error) {
+	var c Comparison
+
+	ra, err := Compile(s, id, a)
+	if err != nil {
+		return c, err
+	}
+
+	rb, err := Compile(s, id, b)
+	if err != nil {
+		return c, err
+	}
+
+	if c.A, err = s.Get(id, a); err != nil {
+		return c, err
+	}
+	if c.B, err = s.Get(id, b); err != nil {
+		return c, err
+	}
+
+	c.ResultA = ra.Eval(params)
+	c.ResultB = rb.Eval(params)
+
+	return c, nil
+}
+
+// next builds the revision following history
+func next(history []Revision, id, expression, author string, now time.Time) (Revision, error) {
+	if strings.TrimSpace(id) == "" {
+		return Revision{}, errors.New("missing rule id")
+	}
+
+	if strings.TrimSpace(author) == "" {
+		return Revision{}, errors.New("missing author")
+	}
+
+	if _, err := evaluator.NewRule(expression, map[string]interface{}{}); err != nil {
+		return Revision{}, fmt.Errorf("invalid expression: %w", err)
+	}
+
+	rev := Revision{
+		RuleID:     id,
+		Version:    len(history) + 1,
+		Expression: expression,
+		Author:     author,
+		Time:       now,
+	}
+
+	if len(history) > 0 {
+		prev := history[len(history)-1]
+		if prev.Expression == expression {
+			return Revision{}, ErrUnchanged
+		}
+
+		rev.Previous = prev.Expression
+		rev.Diff = Diff(prev.Expression, expression)
+	}
+
+	return rev, nil
+}
+
+func find(history []Revision, id string, version int) (Revision, error) {
+	if len(history) == 0 {
+		return Revision{}, fmt.Errorf("rule %q: %w", id, ErrNotFound)
+	}
+
+	if version == 0 {
+		return history[len(history)-1], nil
+	}
+
+	if version < 0 || version > len(history) {
+		return Revision{}, fmt.Errorf("rule %q version %d: %w", id, version, ErrNotFound)
+	}
+
+	return history[version-1], nil
+}
+
+func rollback(history []Revision, id string, version int, author string, now time.Time) (Revision, error) {
+	target, err := find(history, id, version)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev, err := next(history, id, target.Expression, author, now)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev.RollbackOf = target.Version
+	return rev, nil
+}
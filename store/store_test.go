@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	testcases := []struct {
+		from, to string
+		expected string
+	}{
+		{`country == "DE"`, `country == "AT"`, `country == [-"DE"-] {+"AT"+}`},
+		{`a > 1`, `a > 1 AND b contains r"x"`, `a > 1 {+AND b contains r"x"+}`},
+		{`a > 1 AND b < 2`, `b < 2`, `[-a > 1 AND-] b < 2`},
+	}
+
+	for i, tt := range testcases {
+		assert.Equal(t, tt.expected, Diff(tt.from, tt.to), fmt.Sprintf("tests[%d] - diff not equal", i))
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	_, err := s.Get("limit", 0)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = s.Save("limit", "amount >", "alice")
+	assert.Error(t, err)
+
+	v1, err := s.Save("limit", "amount > 100", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, "", v1.Previous)
+
+	_, err = s.Save("limit", "amount > 100", "bob")
+	assert.True(t, errors.Is(err, ErrUnchanged))
+
+	v2, err := s.Save("limit", "amount > 200", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+	assert.Equal(t, "amount > 100", v2.Previous)
+	assert.Equal(t, "amount > [-100-] {+200+}", v2.Diff)
+	assert.Equal(t, "bob", v2.Author)
+
+	// pinned and side by side evaluation
+	r, err := Compile(s, "limit", 1)
+	assert.NoError(t, err)
+	assert.True(t, r.Eval(map[string]interface{}{"amount": 150}))
+
+	c, err := Compare(s, "limit", 1, 2, map[string]interface{}{"amount": 150})
+	assert.NoError(t, err)
+	assert.True(t, c.ResultA)
+	assert.False(t, c.ResultB)
+	assert.False(t, c.Agree())
+
+	v3, err := s.Rollback("limit", 1, "carol")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, v3.Version)
+	assert.Equal(t, 1, v3.RollbackOf)
+	assert.Equal(t, "amount > 100", v3.Expression)
+
+	latest, err := s.Get("limit", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, v3, latest)
+
+	_, err = s.Rollback("limit", 7, "carol")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	history, err := s.History("limit")
+	assert.NoError(t, err)
+	assert.Equal(t, []Revision{v1, v2, v3}, history)
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	s.Now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+	testStore(t, s)
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.Now = func() time.Time { return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) }
+	testStore(t, s)
+
+	// the history survives reopening the store
+	reopened, err := NewFileStore(dir)
+	assert.NoError(t, err)
+	history, err := reopened.History("limit")
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+
+	_, err = reopened.Save("../limit", "true", "alice")
+	assert.Error(t, err)
+}